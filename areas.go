@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"os"
+	"strconv"
+	"strings"
+
+	"slcsp/model"
+	"slcsp/resolver"
+	"slcsp/source"
+)
+
+// runAreas implements the `areas` command, writing one row per rate area with its plan counts,
+// lowest two Silver plan rates and the issuers present
+func runAreas(args []string) error {
+	flags := flag.NewFlagSet("areas", flag.ExitOnError)
+	zips := flags.String("zips", ZipsFileName, "zips file to read")
+	plans := flags.String("plans", PlansFileName, "plans file to read")
+	flags.Parse(args)
+
+	r, err := resolver.Load(context.Background(), source.Files{Zips: *zips, Plans: *plans})
+	if err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(os.Stdout)
+	writer.Write([]string{"state", "rate_area", "plans", "silver_plans", "lowest", "second_lowest", "issuers"})
+	for _, summary := range r.RateAreaSummaries() {
+		writer.Write([]string{
+			summary.RateArea.State,
+			summary.RateArea.Code,
+			strconv.Itoa(summary.Plans),
+			strconv.Itoa(summary.SilverPlans),
+			formatRate(summary.Lowest),
+			formatRate(summary.SecondLowest),
+			strings.Join(summary.Issuers, "|"),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// zipsByRateArea returns the zip codes in each rate area, sorted
+func zipsByRateArea(r *resolver.Resolver) map[model.RateArea][]string {
+	zipsByArea := make(map[model.RateArea][]string)
+	for _, zip := range r.Zips() {
+		for _, rateArea := range r.RateAreas(zip) {
+			zipsByArea[rateArea] = append(zipsByArea[rateArea], zip)
+		}
+	}
+	return zipsByArea
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"slcsp/model"
+	"slcsp/source"
+)
+
+// Categories of audit findings
+const (
+	auditQueryZipMissing      = "query_zip_missing"
+	auditRateAreaWithoutPlans = "rate_area_without_plans"
+	auditPlanWithoutZips      = "plan_without_zips"
+	auditRateAreaFormatting   = "rate_area_formatting"
+	auditRateAreaNotNumeric   = "rate_area_not_numeric"
+)
+
+// AuditReport is the result of cross checking a query file, zips file and plans file
+// Counts has the number of findings in each category, including those without any
+type AuditReport struct {
+	Counts   map[string]int `json:"counts"`
+	Findings []AuditFinding `json:"findings"`
+}
+
+// AuditFinding is a single problem found by an audit
+// Line is set for findings about a line of the query file
+type AuditFinding struct {
+	Category string          `json:"category"`
+	File     string          `json:"file"`
+	Line     int             `json:"line,omitempty"`
+	Zip      string          `json:"zipcode,omitempty"`
+	PlanID   string          `json:"plan_id,omitempty"`
+	RateArea *model.RateArea `json:"rate_area,omitempty"`
+	Detail   string          `json:"detail"`
+}
+
+// add records a finding
+func (r *AuditReport) add(finding AuditFinding) {
+	r.Counts[finding.Category]++
+	r.Findings = append(r.Findings, finding)
+}
+
+// auditFiles cross checks the queries against the dataset, and the zips and plans of the dataset against each other
+func auditFiles(queries []model.Result, dataset *model.Dataset, names source.Files, queryName string) *AuditReport {
+	report := &AuditReport{
+		Counts: map[string]int{
+			auditQueryZipMissing:      0,
+			auditRateAreaWithoutPlans: 0,
+			auditPlanWithoutZips:      0,
+			auditRateAreaFormatting:   0,
+			auditRateAreaNotNumeric:   0,
+		},
+		Findings: make([]AuditFinding, 0),
+	}
+
+	zipAreas := make(map[string][]model.RateArea)
+	areaZips := make(map[model.RateArea]int)
+	for _, zip := range dataset.Zips {
+		zipAreas[zip.Zip] = append(zipAreas[zip.Zip], zip.RateArea)
+		areaZips[zip.RateArea]++
+	}
+	areaPlans := make(map[model.RateArea]int)
+	for _, plan := range dataset.Plans {
+		areaPlans[plan.RateArea]++
+	}
+
+	// Query zip codes that can never have a benchmark
+	for _, query := range queries {
+		if len(zipAreas[query.Zip]) == 0 {
+			report.add(AuditFinding{
+				Category: auditQueryZipMissing,
+				File:     queryName,
+				Line:     query.Line,
+				Zip:      query.Zip,
+				Detail:   fmt.Sprintf("zip code isn't in %s", names.Zips),
+			})
+		}
+	}
+
+	// Rate areas with zip codes but no plans, and plans in rate areas no zip code is in, as `slcsp check` finds them
+	references := checkReferences(dataset)
+	withoutPlans := references.AreasOnlyInZips
+	for i := range withoutPlans {
+		report.add(AuditFinding{
+			Category: auditRateAreaWithoutPlans,
+			File:     names.Zips,
+			RateArea: &withoutPlans[i],
+			Detail:   fmt.Sprintf("rate area has %d rows in %s but no plans in %s", areaZips[withoutPlans[i]], names.Zips, names.Plans),
+		})
+	}
+
+	withoutZips := make(map[model.RateArea]bool, len(references.AreasOnlyInPlans))
+	for _, rateArea := range references.AreasOnlyInPlans {
+		withoutZips[rateArea] = true
+	}
+	for i, plan := range dataset.Plans {
+		if withoutZips[plan.RateArea] {
+			report.add(AuditFinding{
+				Category: auditPlanWithoutZips,
+				File:     names.Plans,
+				PlanID:   plan.ID,
+				RateArea: &dataset.Plans[i].RateArea,
+				Detail:   fmt.Sprintf("plan's rate area has no zip codes in %s", names.Zips),
+			})
+		}
+	}
+
+	// The same rate area written in different ways, which are treated as different rate areas
+	spellings := make(map[model.RateArea]map[model.RateArea]bool)
+	for _, areas := range []map[model.RateArea]int{areaZips, areaPlans} {
+		for rateArea := range areas {
+			key := rateArea.Normalized()
+			if spellings[key] == nil {
+				spellings[key] = make(map[model.RateArea]bool)
+			}
+			spellings[key][rateArea] = true
+		}
+	}
+	keys := make([]model.RateArea, 0)
+	for key, variants := range spellings {
+		if len(variants) > 1 {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Less(keys[j])
+	})
+	for i, key := range keys {
+		variants := make([]string, 0, len(spellings[key]))
+		for rateArea := range spellings[key] {
+			variants = append(variants, fmt.Sprintf("%q", rateArea.State+" "+rateArea.Code))
+		}
+		sort.Strings(variants)
+		report.add(AuditFinding{
+			Category: auditRateAreaFormatting,
+			File:     names.Zips + ", " + names.Plans,
+			RateArea: &keys[i],
+			Detail:   "rate area is written as " + strings.Join(variants, ", "),
+		})
+	}
+
+	// Rate area codes that aren't numbers, such as "3A" or "3-4", which can't be told apart from typos or
+	// ranges and sort and normalize unlike the rest
+	for _, check := range []struct {
+		file  string
+		areas map[model.RateArea]int
+		rows  string
+	}{{names.Zips, areaZips, "rows"}, {names.Plans, areaPlans, "plans"}} {
+		notNumeric := make([]model.RateArea, 0)
+		for rateArea := range check.areas {
+			if !isNumber(strings.TrimSpace(rateArea.Code)) {
+				notNumeric = append(notNumeric, rateArea)
+			}
+		}
+		sort.Slice(notNumeric, func(i, j int) bool {
+			return notNumeric[i].Less(notNumeric[j])
+		})
+		for i := range notNumeric {
+			report.add(AuditFinding{
+				Category: auditRateAreaNotNumeric,
+				File:     check.file,
+				RateArea: &notNumeric[i],
+				Detail:   fmt.Sprintf("rate_area %q isn't a number, on %d %s", notNumeric[i].Code, check.areas[notNumeric[i]], check.rows),
+			})
+		}
+	}
+
+	return report
+}
+
+// isNumber reports whether s is made of one or more ASCII digits
+func isNumber(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// misspelledRateAreas finds the rate areas wanted, such as those of the queried zip codes, that have no plans
+// as they're written but do once normalized, describing each with how the plans write it, in order
+// wantedFrom and plansFrom name where the rate areas and plans were read from
+func misspelledRateAreas(wanted map[model.RateArea]bool, wantedFrom string, plans []model.Plan, plansFrom string) []string {
+	planAreas := make(map[model.RateArea]bool)
+	spellings := make(map[model.RateArea]map[string]bool)
+	for _, plan := range plans {
+		planAreas[plan.RateArea] = true
+		key := plan.RateArea.Normalized()
+		if spellings[key] == nil {
+			spellings[key] = make(map[string]bool)
+		}
+		spellings[key][fmt.Sprintf("%q", plan.RateArea.String())] = true
+	}
+
+	areas := make([]model.RateArea, 0)
+	for rateArea := range wanted {
+		if !planAreas[rateArea] && spellings[rateArea.Normalized()] != nil {
+			areas = append(areas, rateArea)
+		}
+	}
+	sort.Slice(areas, func(i, j int) bool {
+		return areas[i].Less(areas[j])
+	})
+	described := make([]string, 0, len(areas))
+	for _, rateArea := range areas {
+		variants := make([]string, 0)
+		for variant := range spellings[rateArea.Normalized()] {
+			variants = append(variants, variant)
+		}
+		sort.Strings(variants)
+		described = append(described, fmt.Sprintf("rate area %q of %s is written %s in %s, so it has no plans", rateArea.String(), wantedFrom, strings.Join(variants, ", "), plansFrom))
+	}
+	return described
+}
+
+// runAudit implements the `audit` command, cross checking a query file, zips file and plans file and
+// writing a JSON report of the problems found by category
+// It exits with status 1 when there are any
+func runAudit(args []string) error {
+	flags := flag.NewFlagSet("audit", flag.ExitOnError)
+	queries := flags.String("slcsp", SlcspFileName, "query file to read")
+	zips := flags.String("zips", ZipsFileName, "zips file to read")
+	plans := flags.String("plans", PlansFileName, "plans file to read")
+	flags.Parse(args)
+
+	results, err := source.ReadQueriesFile(*queries, source.Options{})
+	if err != nil {
+		return err
+	}
+	files := source.Files{Zips: *zips, Plans: *plans}
+	dataset, err := files.Load(context.Background())
+	if err != nil {
+		return err
+	}
+
+	report := auditFiles(results, dataset, files, *queries)
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+	if len(report.Findings) > 0 {
+		os.Exit(1)
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+//go:build baked
+// +build baked
+
+package main
+
+import (
+	"embed"
+	"io/fs"
+)
+
+// bakedFiles is the zips.csv and plans.csv snapshot copied into baked/ before building with -tags baked
+//
+//go:embed baked/zips.csv baked/plans.csv
+var bakedFiles embed.FS
+
+func init() {
+	bakedDataset, _ = fs.Sub(bakedFiles, "baked")
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"slcsp/model"
+	"slcsp/source"
+)
+
+// queryBatch is a query file, where its results are written and the results themselves
+// An empty Output means stdout
+type queryBatch struct {
+	Input   string
+	Output  string
+	Results []model.Result
+}
+
+// toStdout reports whether the results of any batch are written to stdout rather than a file
+func toStdout(batches []queryBatch) bool {
+	for _, batch := range batches {
+		if batch.Output == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// expandQueryFiles expands any glob patterns among the query file arguments, for shells that don't,
+// keeping other names as given
+func expandQueryFiles(args []string) ([]string, error) {
+	files := make([]string, 0, len(args))
+	for _, arg := range args {
+		if !strings.ContainsAny(arg, "*?[") {
+			files = append(files, arg)
+			continue
+		}
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", arg, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("%s: no files match", arg)
+		}
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+// batchOutputName returns the name of the output file for a query file, inserting suffix before its extension
+func batchOutputName(input string, suffix string) string {
+	ext := filepath.Ext(input)
+	return strings.TrimSuffix(input, ext) + suffix + ext
+}
+
+// stdinName is the query file argument that reads from stdin, whose results go to stdout
+const stdinName = "-"
+
+// queryBatches returns a batch for each query file argument, with its output file alongside it
+// Without arguments there is a single batch reading SlcspFileName and writing to stdout
+func queryBatches(args []string, suffix string) ([]queryBatch, error) {
+	if len(args) == 0 {
+		return []queryBatch{{Input: SlcspFileName}}, nil
+	}
+	if suffix == "" {
+		return nil, fmt.Errorf("-suffix can't be empty, or query files would be overwritten by their results")
+	}
+
+	files, err := expandQueryFiles(args)
+	if err != nil {
+		return nil, err
+	}
+	batches := make([]queryBatch, 0, len(files))
+	for _, file := range files {
+		// Results for stdin or a process substitution go to stdout, as there's no file to put them beside
+		if file == stdinName || isStream(file) {
+			batches = append(batches, queryBatch{Input: file})
+			continue
+		}
+
+		// Skip the output of an earlier run, when a pattern matches it as well as the query files
+		if strings.HasSuffix(strings.TrimSuffix(file, filepath.Ext(file)), suffix) {
+			continue
+		}
+		batches = append(batches, queryBatch{Input: file, Output: batchOutputName(file, suffix)})
+	}
+	return batches, nil
+}
+
+// dirBatches returns a batch for each CSV file in the inputDir tree, with its output file at the same
+// place in the outputDir tree
+func dirBatches(inputDir string, outputDir string) ([]queryBatch, error) {
+	if inputDir == "" || outputDir == "" {
+		return nil, fmt.Errorf("-input-dir and -output-dir must be used together")
+	}
+	outputAbs, err := filepath.Abs(outputDir)
+	if err != nil {
+		return nil, err
+	}
+
+	batches := make([]queryBatch, 0)
+	err = filepath.WalkDir(inputDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			// Don't read back results when the output directory is inside the input directory
+			if abs, err := filepath.Abs(path); err == nil && abs == outputAbs {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.EqualFold(filepath.Ext(path), ".csv") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(inputDir, path)
+		if err != nil {
+			return err
+		}
+		if rel == batchIndexFileName {
+			return fmt.Errorf("%s: its results would be overwritten by the %s written to -output-dir", path, batchIndexFileName)
+		}
+		batches = append(batches, queryBatch{Input: path, Output: filepath.Join(outputDir, rel)})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(batches) == 0 {
+		return nil, fmt.Errorf("%s: no CSV files found", inputDir)
+	}
+	return batches, nil
+}
+
+// writeBatchIndex writes a CSV summary of every batch: where its results were written and how many
+// of its zip codes have a benchmark
+func writeBatchIndex(fileName string, batches []queryBatch) error {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(file)
+	writer.Write([]string{"input", "output", "zipcodes", "with_rate", "blank", "ambiguous"})
+	for _, batch := range batches {
+		counts := countResults(batch.Results)
+		writer.Write([]string{
+			batch.Input,
+			batch.Output,
+			strconv.Itoa(counts.Zips),
+			strconv.Itoa(counts.WithRate),
+			strconv.Itoa(counts.Blank),
+			strconv.Itoa(counts.Ambiguous),
+		})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// openFunc opens an input file by name
+type openFunc func(name string) (fs.File, error)
+
+// openOS opens input files from the file system
+func openOS(name string) (fs.File, error) {
+	return os.Open(name)
+}
+
+// readQueries reads a query file, or stdin, with read, which is source.ReadQueries for the usual CSV files
+func readQueries(open openFunc, fileName string, opts source.Options, read queryReader) ([]model.Result, error) {
+	var r io.Reader = os.Stdin
+	name := "stdin"
+	if fileName != stdinName {
+		file, err := open(fileName)
+		if err != nil {
+			return make([]model.Result, 0), err
+		}
+		defer file.Close()
+		r, name = file, fileName
+	}
+	return read(name, r, opts)
+}
+
+// queryReader reads the queries of a file, such as source.ReadQueries
+type queryReader func(fileName string, r io.Reader, opts source.Options) ([]model.Result, error)
+
+// readZipList is a queryReader for plain lists of zip codes
+func readZipList(fileName string, r io.Reader, opts source.Options) ([]model.Result, error) {
+	return source.ReadZipList(fileName, r)
+}
+
+// readZips reads ZipsFileName
+func readZips(open openFunc, opts source.Options) ([]model.ZipMapping, error) {
+	file, err := open(ZipsFileName)
+	if err != nil {
+		return make([]model.ZipMapping, 0), err
+	}
+	defer file.Close()
+	return source.ReadZips(ZipsFileName, file, opts)
+}
+
+// readPlans reads PlansFileName
+func readPlans(open openFunc, opts source.Options) ([]model.Plan, error) {
+	file, err := open(PlansFileName)
+	if err != nil {
+		return make([]model.Plan, 0), err
+	}
+	defer file.Close()
+	return source.ReadPlans(PlansFileName, file, opts)
+}
+
+// readIndexedRows reads the rows with the keys given of the named file, using the row index beside it, and
+// reports false without reading anything if there's no index, it's out of date or it's keyed by other columns
+// read is given the rows and the file line of each line of them, for source.Options.FileLine
+// Having none of the keys isn't an error, as the rows read may be only a few of the file's
+// A missing index is only logged if verbose is set, as the file being read in full is then expected
+func readIndexedRows(fileName string, key string, keys []string, verbose bool, read func(r io.Reader, fileLine func(line int) int) error) (bool, error) {
+	idx, err := source.ReadRowIndex(fileName+source.RowIndexSuffix, keys)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Warning: %v", err)
+		} else if verbose {
+			log.Printf("%s has no row index, so all of it is read; write one with slcsp index rows", fileName)
+		}
+		return false, nil
+	}
+	file, err := os.Open(fileName)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return false, err
+	}
+	if !idx.Matches(info, key) {
+		log.Printf("Warning: %s%s is out of date, so all of %s is read; rebuild it with slcsp index rows", fileName, source.RowIndexSuffix, fileName)
+		return false, nil
+	}
+
+	rows := idx.Reader(file, keys)
+	var noData *source.NoDataError
+	if err := read(rows, rows.FileLine); err != nil && !errors.As(err, &noData) {
+		return true, err
+	}
+	return true, nil
+}
+
+// readZipsEarly reads the rows of ZipsFileName for the zip codes given, using its row index if it has an
+// up to date one rather than scanning the whole file, and logging when it doesn't if verbose is set
+func readZipsEarly(open openFunc, opts source.Options, queried []string, verbose bool) ([]model.ZipMapping, error) {
+	var zips []model.ZipMapping
+	indexed, err := readIndexedRows(ZipsFileName, source.ZipRowKey(opts), queried, verbose, func(r io.Reader, fileLine func(int) int) (err error) {
+		opts.FileLine = fileLine
+		zips, err = source.ReadZips(ZipsFileName, r, opts)
+		return err
+	})
+	if !indexed && err == nil {
+		return readZips(open, opts)
+	}
+	return zips, err
+}
+
+// readPlansEarly reads the rows of PlansFileName for opts.RateAreas, using its row index if it has an up to
+// date one rather than scanning the whole file, and logging when it doesn't if verbose is set
+func readPlansEarly(open openFunc, opts source.Options, verbose bool) ([]model.Plan, error) {
+	areas := make([]string, 0, len(opts.RateAreas))
+	for area := range opts.RateAreas {
+		areas = append(areas, area.Key())
+	}
+	var plans []model.Plan
+	indexed, err := readIndexedRows(PlansFileName, source.PlanRowKey(opts), areas, verbose, func(r io.Reader, fileLine func(int) int) (err error) {
+		opts.FileLine = fileLine
+		plans, err = source.ReadPlans(PlansFileName, r, opts)
+		return err
+	})
+	if !indexed && err == nil {
+		return readPlans(open, opts)
+	}
+	return plans, err
+}
+
+// writeResultsFile writes results to the named file, creating its directory if needed, or to stdout if the name is empty
+func writeResultsFile(fileName string, results []model.Result, opts OutputOptions) error {
+	if fileName == "" {
+		return writeResults(os.Stdout, results, opts)
+	}
+	if err := os.MkdirAll(filepath.Dir(fileName), 0755); err != nil {
+		return err
+	}
+	file, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	if err := writeResults(file, results, opts); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
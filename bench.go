@@ -0,0 +1,129 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"slcsp/model"
+	"slcsp/resolver"
+	"slcsp/source"
+)
+
+// benchStage is the time a stage of a run took, as the fastest of the runs, and how many rows it handled
+type benchStage struct {
+	Name string
+	Rows int
+	Best time.Duration
+}
+
+// runBench implements the `bench` command, timing each stage of answering a query file over the inputs
+// and printing a breakdown, so the effect of a bigger dataset or of -fast-csv and the prefilter can be measured
+func runBench(args []string) error {
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	queries := flags.String("slcsp", SlcspFileName, "query file to read")
+	zips := flags.String("zips", ZipsFileName, "zips file to read")
+	plans := flags.String("plans", PlansFileName, "plans file to read")
+	runs := flags.Int("runs", 3, "number of times to run every stage, keeping the fastest")
+	fastCSV := flags.Bool("fast-csv", false, "read the input files with the faster CSV parser")
+	noPrefilter := flags.Bool("no-prefilter", false, "keep every row of the zips file rather than only the queried zip codes")
+	flags.Parse(args)
+
+	if *runs < 1 {
+		return fmt.Errorf("-runs must be at least 1")
+	}
+	opts := source.Options{FastCSV: *fastCSV}
+
+	stages := []*benchStage{
+		{Name: "parse queries"},
+		{Name: "parse zips"},
+		{Name: "parse plans"},
+		{Name: "index"},
+		{Name: "resolve"},
+		{Name: "write"},
+	}
+	// timed runs a stage, keeping its time if it's the fastest yet
+	timed := func(stage *benchStage, run func() (int, error)) error {
+		start := time.Now()
+		rows, err := run()
+		elapsed := time.Since(start)
+		if err != nil {
+			return err
+		}
+		if stage.Best == 0 || elapsed < stage.Best {
+			stage.Best = elapsed
+		}
+		stage.Rows = rows
+		return nil
+	}
+
+	for i := 0; i < *runs; i++ {
+		var results []model.Result
+		var zipMappings []model.ZipMapping
+		var planRows []model.Plan
+		var r *resolver.Resolver
+
+		err := timed(stages[0], func() (int, error) {
+			var err error
+			results, err = source.ReadQueriesFile(*queries, opts)
+			return len(results), err
+		})
+		if err == nil {
+			err = timed(stages[1], func() (int, error) {
+				zipsOpts := opts
+				if !*noPrefilter {
+					queried := make([]string, 0, len(results))
+					for _, result := range results {
+						queried = append(queried, result.Zip)
+					}
+					zipsOpts.Zips = source.NewZipFilter(queried)
+				}
+				var err error
+				zipMappings, err = source.ReadZipsFile(*zips, zipsOpts)
+				return len(zipMappings), err
+			})
+		}
+		if err == nil {
+			err = timed(stages[2], func() (int, error) {
+				var err error
+				planRows, err = source.ReadPlansFile(*plans, opts)
+				return len(planRows), err
+			})
+		}
+		if err == nil {
+			err = timed(stages[3], func() (int, error) {
+				r = resolver.New(zipMappings, planRows)
+				return len(zipMappings) + len(planRows), nil
+			})
+		}
+		if err == nil {
+			err = timed(stages[4], func() (int, error) {
+				for i, result := range results {
+					results[i] = r.Lookup(result.Zip)
+				}
+				return len(results), nil
+			})
+		}
+		if err == nil {
+			err = timed(stages[5], func() (int, error) {
+				return len(results), writeResults(io.Discard, results, OutputOptions{})
+			})
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "stage\trows\ttime\n")
+	total := time.Duration(0)
+	for _, stage := range stages {
+		fmt.Fprintf(tw, "%s\t%d\t%s\n", stage.Name, stage.Rows, stage.Best.Round(time.Microsecond))
+		total += stage.Best
+	}
+	fmt.Fprintf(tw, "total\t\t%s\n", total.Round(time.Microsecond))
+	return tw.Flush()
+}
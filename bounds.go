@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+
+	"slcsp/model"
+)
+
+// rateBounds are the lowest and highest plausible plan rates, where zero is no bound
+type rateBounds struct {
+	Min float64
+	Max float64
+}
+
+// check returns an error if the bounds can't both hold
+func (b rateBounds) check() error {
+	if b.Min < 0 || b.Max < 0 {
+		return fmt.Errorf("-min-rate and -max-rate can't be negative")
+	}
+	if b.Max != 0 && b.Min > b.Max {
+		return fmt.Errorf("-min-rate %v is above -max-rate %v", b.Min, b.Max)
+	}
+	return nil
+}
+
+// contains reports whether a rate is within the bounds
+func (b rateBounds) contains(rate float64) bool {
+	return (b.Min == 0 || rate >= b.Min) && (b.Max == 0 || rate <= b.Max)
+}
+
+// applyRateBounds warns about each plan whose rate is outside the bounds, such as from a shifted decimal
+// point or a rate in the wrong units, leaving them out of the plans returned if exclude is set
+func applyRateBounds(plans []model.Plan, bounds rateBounds, exclude bool, warnings *warningLog) []model.Plan {
+	if bounds == (rateBounds{}) {
+		return plans
+	}
+	kept := plans[:0]
+	for _, plan := range plans {
+		if bounds.contains(plan.Rate) {
+			kept = append(kept, plan)
+			continue
+		}
+		action := "using it anyway"
+		if exclude {
+			action = "leaving it out"
+		} else {
+			kept = append(kept, plan)
+		}
+		warnings.warn("rate bounds", fmt.Sprintf("plan %s in rate area %s %s has rate %.2f, outside -min-rate and -max-rate; %s", plan.ID, plan.RateArea.State, plan.RateArea.Code, plan.Rate, action))
+	}
+	return kept
+}
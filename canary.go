@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+
+	"slcsp/index"
+	"slcsp/model"
+	"slcsp/resolver"
+	"slcsp/source"
+)
+
+// canaryEngine is another way of answering lookups, checked against the resolver over the full inputs
+// lookup is nil if the engine has nothing to run over, such as missing row indexes, with why in skipped
+type canaryEngine struct {
+	Name    string
+	lookup  func(zip string) (model.Result, error)
+	skipped string
+}
+
+// sameResult reports whether two engines gave the same answer for a zip code
+// Counties aren't compared, as the binary index doesn't hold them
+func sameResult(a model.Result, b model.Result) bool {
+	if a.Ambiguous != b.Ambiguous || a.RateArea != b.RateArea || (a.Rate == nil) != (b.Rate == nil) {
+		return false
+	}
+	return a.Rate == nil || *a.Rate == *b.Rate
+}
+
+// runCanary implements the `canary` command, answering a query file with the resolver over the full inputs
+// and with each other engine over the same inputs, and failing on any zip code where they differ, so a
+// faster engine can be trusted before it's relied on
+func runCanary(args []string) error {
+	flags := flag.NewFlagSet("canary", flag.ExitOnError)
+	queries := flags.String("slcsp", SlcspFileName, "query file to read")
+	zips := flags.String("zips", ZipsFileName, "zips file to read")
+	plans := flags.String("plans", PlansFileName, "plans file to read")
+	flags.Parse(args)
+
+	results, err := source.ReadQueriesFile(*queries, source.Options{})
+	if err != nil {
+		return err
+	}
+	queried := make([]string, 0, len(results))
+	for _, result := range results {
+		queried = append(queried, result.Zip)
+	}
+
+	// The reference: every row of both files, indexed by the resolver
+	zipMappings, err := source.ReadZipsFile(*zips, source.Options{})
+	if err != nil {
+		return err
+	}
+	planRows, err := source.ReadPlansFile(*plans, source.Options{})
+	if err != nil {
+		return err
+	}
+	reference := resolver.New(zipMappings, planRows)
+
+	engines := make([]canaryEngine, 0)
+	for _, newEngine := range []func() (canaryEngine, error){
+		func() (canaryEngine, error) { return canaryIndexEngine(reference) },
+		func() (canaryEngine, error) { return canaryPrefilterEngine(*zips, *plans, queried) },
+		func() (canaryEngine, error) { return canaryRowsEngine(*zips, *plans, queried) },
+	} {
+		engine, err := newEngine()
+		if err != nil {
+			return fmt.Errorf("%s: %w", engine.Name, err)
+		}
+		engines = append(engines, engine)
+	}
+
+	divergences := 0
+	for _, engine := range engines {
+		if engine.lookup == nil {
+			fmt.Printf("%s: skipped, %s\n", engine.Name, engine.skipped)
+			continue
+		}
+		differ := 0
+		for _, zip := range queried {
+			want := reference.Lookup(zip)
+			got, err := engine.lookup(zip)
+			if err != nil {
+				return fmt.Errorf("%s: %w", engine.Name, err)
+			}
+			if !sameResult(want, got) {
+				differ++
+				fmt.Printf("%s: %s: got %s, expected %s\n", engine.Name, zip, describeResult(got), describeResult(want))
+			}
+		}
+		if differ == 0 {
+			fmt.Printf("%s: %d zip codes agree\n", engine.Name, len(queried))
+		}
+		divergences += differ
+	}
+
+	if divergences > 0 {
+		return fmt.Errorf("%d lookups differ from the resolver", divergences)
+	}
+	return nil
+}
+
+// describeResult describes a result's answer for a divergence report
+func describeResult(result model.Result) string {
+	switch {
+	case result.Ambiguous:
+		return "ambiguous"
+	case result.RateArea.IsZero():
+		return "not found"
+	case result.Rate == nil:
+		return fmt.Sprintf("%s with no rate", result.RateArea)
+	}
+	return fmt.Sprintf("%s at %s", result.RateArea, formatRate(result.Rate))
+}
+
+// canaryIndexEngine answers from the binary index written by `slcsp index build`, round tripped through memory
+func canaryIndexEngine(r *resolver.Resolver) (canaryEngine, error) {
+	engine := canaryEngine{Name: "index"}
+	var buf bytes.Buffer
+	if err := index.Write(&buf, r); err != nil {
+		return engine, err
+	}
+	idx, err := index.Parse(buf.Bytes())
+	if err != nil {
+		return engine, err
+	}
+	engine.lookup = idx.Lookup
+	return engine, nil
+}
+
+// canaryPrefilterEngine answers from only the queried zip codes' rows and their rate areas' plans, as
+// read by default and under -max-memory
+func canaryPrefilterEngine(zips string, plans string, queried []string) (canaryEngine, error) {
+	engine := canaryEngine{Name: "prefilter"}
+	zipMappings, err := source.ReadZipsFile(zips, source.Options{Zips: source.NewZipFilter(queried)})
+	if err != nil {
+		return engine, err
+	}
+	planRows, err := source.ReadPlansFile(plans, source.Options{RateAreas: zipRateAreas(zipMappings)})
+	if err != nil {
+		return engine, err
+	}
+	r := resolver.New(zipMappings, planRows)
+	engine.lookup = func(zip string) (model.Result, error) { return r.Lookup(zip), nil }
+	return engine, nil
+}
+
+// canaryRowsEngine answers from the rows read through the row indexes of -exit-early, if there are up to date ones
+func canaryRowsEngine(zips string, plans string, queried []string) (canaryEngine, error) {
+	engine := canaryEngine{Name: "rows", skipped: "no up to date row indexes; write them with slcsp index rows"}
+	var zipMappings []model.ZipMapping
+	indexed, err := readIndexedRows(zips, source.ZipRowKey(source.Options{}), queried, false, func(r io.Reader, fileLine func(int) int) (err error) {
+		zipMappings, err = source.ReadZips(zips, r, source.Options{FileLine: fileLine})
+		return err
+	})
+	if err != nil {
+		return engine, err
+	}
+	if !indexed {
+		return engine, nil
+	}
+
+	areas := make([]string, 0)
+	for area := range zipRateAreas(zipMappings) {
+		areas = append(areas, area.Key())
+	}
+	var planRows []model.Plan
+	indexed, err = readIndexedRows(plans, source.PlanRowKey(source.Options{}), areas, false, func(r io.Reader, fileLine func(int) int) (err error) {
+		planRows, err = source.ReadPlans(plans, r, source.Options{FileLine: fileLine})
+		return err
+	})
+	if err != nil {
+		return engine, err
+	}
+	if !indexed {
+		return engine, nil
+	}
+
+	r := resolver.New(zipMappings, planRows)
+	engine.lookup = func(zip string) (model.Result, error) { return r.Lookup(zip), nil }
+	return engine, nil
+}
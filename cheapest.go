@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+
+	"slcsp/model"
+	"slcsp/resolver"
+	"slcsp/source"
+)
+
+// runCheapest implements the `cheapest` command, listing the zip codes or rate areas whose benchmark
+// is at or below a threshold, cheapest first
+func runCheapest(args []string) error {
+	flags := flag.NewFlagSet("cheapest", flag.ExitOnError)
+	maxRate := flags.Float64("max", 0, "highest benchmark to include")
+	by := flags.String("by", "zips", "list zips or areas (rate areas)")
+	zips := flags.String("zips", ZipsFileName, "zips file to read")
+	plans := flags.String("plans", PlansFileName, "plans file to read")
+	flags.Parse(args)
+
+	maxSet := false
+	flags.Visit(func(f *flag.Flag) { maxSet = maxSet || f.Name == "max" })
+	if !maxSet {
+		return fmt.Errorf("usage: slcsp cheapest -max 250 [-by zips|areas]")
+	}
+	if *by != "zips" && *by != "areas" {
+		return fmt.Errorf("unknown -by %q, expected zips or areas", *by)
+	}
+
+	r, err := resolver.Load(context.Background(), source.Files{Zips: *zips, Plans: *plans})
+	if err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(os.Stdout)
+	if *by == "areas" {
+		zipsByArea := zipsByRateArea(r)
+		summaries := make([]model.RateAreaSummary, 0)
+		for _, summary := range r.RateAreaSummaries() {
+			if summary.SecondLowest != nil && *summary.SecondLowest <= *maxRate {
+				summaries = append(summaries, summary)
+			}
+		}
+		// RateAreaSummaries is sorted by rate area, which a stable sort keeps for equal benchmarks
+		sort.SliceStable(summaries, func(i, j int) bool {
+			return *summaries[i].SecondLowest < *summaries[j].SecondLowest
+		})
+
+		writer.Write([]string{"state", "rate_area", "rate", "zipcodes"})
+		for _, summary := range summaries {
+			writer.Write([]string{summary.RateArea.State, summary.RateArea.Code, formatRate(summary.SecondLowest), strconv.Itoa(len(zipsByArea[summary.RateArea]))})
+		}
+	} else {
+		results := make([]model.Result, 0)
+		for _, zip := range r.Zips() {
+			if result := r.Lookup(zip); result.Rate != nil && *result.Rate <= *maxRate {
+				results = append(results, result)
+			}
+		}
+		// Zips is sorted by zip code, which a stable sort keeps for equal benchmarks
+		sort.SliceStable(results, func(i, j int) bool {
+			return *results[i].Rate < *results[j].Rate
+		})
+
+		writer.Write([]string{"zipcode", "state", "rate_area", "rate"})
+		for _, result := range results {
+			writer.Write([]string{result.Zip, result.RateArea.State, result.RateArea.Code, formatRate(result.Rate)})
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"slcsp/model"
+	"slcsp/source"
+)
+
+// ReferenceReport lists the rate areas and states found in only one of the zips and plans files
+// States missing from one file entirely are a sign the two files come from different vintages
+type ReferenceReport struct {
+	AreasOnlyInZips   []model.RateArea
+	AreasOnlyInPlans  []model.RateArea
+	StatesOnlyInZips  []string
+	StatesOnlyInPlans []string
+}
+
+// OK reports whether the files reference each other completely
+func (r ReferenceReport) OK() bool {
+	return len(r.AreasOnlyInZips) == 0 && len(r.AreasOnlyInPlans) == 0 &&
+		len(r.StatesOnlyInZips) == 0 && len(r.StatesOnlyInPlans) == 0
+}
+
+// checkReferences compares the rate areas and states of the zip code mappings and plans in dataset
+func checkReferences(dataset *model.Dataset) ReferenceReport {
+	zipAreas := make(map[model.RateArea]bool)
+	zipStates := make(map[string]bool)
+	for _, zip := range dataset.Zips {
+		zipAreas[zip.RateArea] = true
+		zipStates[zip.RateArea.State] = true
+	}
+
+	planAreas := make(map[model.RateArea]bool)
+	planStates := make(map[string]bool)
+	for _, plan := range dataset.Plans {
+		planAreas[plan.RateArea] = true
+		planStates[plan.RateArea.State] = true
+	}
+
+	return ReferenceReport{
+		AreasOnlyInZips:   missingAreas(zipAreas, planAreas),
+		AreasOnlyInPlans:  missingAreas(planAreas, zipAreas),
+		StatesOnlyInZips:  missingStates(zipStates, planStates),
+		StatesOnlyInPlans: missingStates(planStates, zipStates),
+	}
+}
+
+// missingAreas returns the rate areas in have that aren't in other, sorted
+func missingAreas(have map[model.RateArea]bool, other map[model.RateArea]bool) []model.RateArea {
+	missing := make([]model.RateArea, 0)
+	for rateArea := range have {
+		if !other[rateArea] {
+			missing = append(missing, rateArea)
+		}
+	}
+	sort.Slice(missing, func(i, j int) bool {
+		return missing[i].Less(missing[j])
+	})
+	return missing
+}
+
+// missingStates returns the states in have that aren't in other, sorted
+func missingStates(have map[string]bool, other map[string]bool) []string {
+	missing := make([]string, 0)
+	for state := range have {
+		if !other[state] {
+			missing = append(missing, state)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// printReferenceReport writes a ReferenceReport in a human readable layout
+func printReferenceReport(w io.Writer, report ReferenceReport, zipsName string, plansName string) {
+	if report.OK() {
+		fmt.Fprintf(w, "%s and %s reference the same rate areas\n", zipsName, plansName)
+		return
+	}
+
+	printList := func(title string, values []string) {
+		if len(values) == 0 {
+			return
+		}
+		fmt.Fprintf(w, "%s (%d):\n", title, len(values))
+		for _, value := range values {
+			fmt.Fprintf(w, "  %s\n", value)
+		}
+	}
+	areaStrings := func(areas []model.RateArea) []string {
+		values := make([]string, 0, len(areas))
+		for _, rateArea := range areas {
+			values = append(values, rateArea.String())
+		}
+		return values
+	}
+
+	printList("States in "+zipsName+" but not "+plansName, report.StatesOnlyInZips)
+	printList("States in "+plansName+" but not "+zipsName, report.StatesOnlyInPlans)
+	printList("Rate areas in "+zipsName+" but not "+plansName, areaStrings(report.AreasOnlyInZips))
+	printList("Rate areas in "+plansName+" but not "+zipsName, areaStrings(report.AreasOnlyInPlans))
+}
+
+// runCheck implements the `check` command, comparing the rate areas and states of the zips and plans files
+// It exits with status 1 when they don't match
+func runCheck(args []string) error {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	zips := flags.String("zips", ZipsFileName, "zips file to read")
+	plans := flags.String("plans", PlansFileName, "plans file to read")
+	flags.Parse(args)
+
+	dataset, err := source.Files{Zips: *zips, Plans: *plans}.Load(context.Background())
+	if err != nil {
+		return err
+	}
+
+	report := checkReferences(dataset)
+	printReferenceReport(os.Stdout, report, *zips, *plans)
+	if !report.OK() {
+		os.Exit(1)
+	}
+	return nil
+}
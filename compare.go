@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+
+	"slcsp/resolver"
+	"slcsp/source"
+)
+
+// Statuses of a ZipChange
+const (
+	StatusGained    = "gained"
+	StatusLost      = "lost"
+	StatusChanged   = "changed"
+	StatusUnchanged = "unchanged"
+	StatusNone      = "none"
+)
+
+// ZipChange is the difference in a zip code's benchmark between an old and a new dataset
+// Old and New are nil when there was no SLCSP for the zip code in that dataset
+type ZipChange struct {
+	Zip   string
+	State string
+	Old   *float64
+	New   *float64
+}
+
+// Status describes how the zip code's coverage changed between the datasets
+func (c ZipChange) Status() string {
+	switch {
+	case c.Old == nil && c.New == nil:
+		return StatusNone
+	case c.Old == nil:
+		return StatusGained
+	case c.New == nil:
+		return StatusLost
+	case *c.Old != *c.New:
+		return StatusChanged
+	default:
+		return StatusUnchanged
+	}
+}
+
+// Change returns the absolute and percent change in the benchmark
+// Both are only meaningful when the zip code has a benchmark in both datasets
+func (c ZipChange) Change() (float64, float64) {
+	if c.Old == nil || c.New == nil {
+		return 0, 0
+	}
+	change := *c.New - *c.Old
+	return change, change / *c.Old * 100
+}
+
+// compareResolvers determines the change for every zip code found in either resolver, sorted by zip code
+func compareResolvers(before *resolver.Resolver, after *resolver.Resolver) []ZipChange {
+	zips := before.Zips()
+	for _, zip := range after.Zips() {
+		if len(before.RateAreas(zip)) == 0 {
+			zips = append(zips, zip)
+		}
+	}
+	sort.Strings(zips)
+
+	changes := make([]ZipChange, 0, len(zips))
+	for _, zip := range zips {
+		change := ZipChange{Zip: zip, Old: before.Lookup(zip).Rate, New: after.Lookup(zip).Rate}
+
+		// Take the state from whichever dataset has the zip code
+		if areas := after.RateAreas(zip); len(areas) > 0 {
+			change.State = areas[0].State
+		} else if areas := before.RateAreas(zip); len(areas) > 0 {
+			change.State = areas[0].State
+		}
+
+		changes = append(changes, change)
+	}
+
+	return changes
+}
+
+// biggestMovers returns up to top changes per state with the largest absolute benchmark change,
+// ordered by state and then by size of change
+func biggestMovers(changes []ZipChange, top int) []ZipChange {
+	byState := make(map[string][]ZipChange)
+	for _, change := range changes {
+		if change.Status() == StatusChanged {
+			byState[change.State] = append(byState[change.State], change)
+		}
+	}
+
+	states := make([]string, 0, len(byState))
+	for state := range byState {
+		states = append(states, state)
+	}
+	sort.Strings(states)
+
+	movers := make([]ZipChange, 0)
+	for _, state := range states {
+		stateChanges := byState[state]
+		sort.SliceStable(stateChanges, func(i, j int) bool {
+			a, _ := stateChanges[i].Change()
+			b, _ := stateChanges[j].Change()
+			return math.Abs(a) > math.Abs(b)
+		})
+		if len(stateChanges) > top {
+			stateChanges = stateChanges[:top]
+		}
+		movers = append(movers, stateChanges...)
+	}
+
+	return movers
+}
+
+// formatRate formats an optional rate with two decimal places, leaving it blank when there is none
+func formatRate(rate *float64) string {
+	if rate == nil {
+		return ""
+	}
+	return fmt.Sprintf("%.2f", *rate)
+}
+
+// writeChanges writes changes as CSV
+func writeChanges(w io.Writer, changes []ZipChange) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"zipcode", "state", "old_rate", "new_rate", "change", "percent_change", "status"})
+	for _, change := range changes {
+		record := []string{change.Zip, change.State, formatRate(change.Old), formatRate(change.New), "", "", change.Status()}
+		if change.Old != nil && change.New != nil {
+			absolute, percent := change.Change()
+			record[4] = fmt.Sprintf("%.2f", absolute)
+			record[5] = fmt.Sprintf("%.2f", percent)
+		}
+		writer.Write(record)
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// runCompare implements the `compare` command, reporting how benchmarks changed between two datasets
+func runCompare(args []string) error {
+	flags := flag.NewFlagSet("compare", flag.ExitOnError)
+	oldZips := flags.String("old-zips", "", "zips file of the earlier plan year")
+	oldPlans := flags.String("old-plans", "", "plans file of the earlier plan year")
+	newZips := flags.String("new-zips", ZipsFileName, "zips file of the later plan year")
+	newPlans := flags.String("new-plans", PlansFileName, "plans file of the later plan year")
+	report := flags.String("report", "zips", "report to output: zips (every zip code), movers (biggest changes per state) or coverage (zip codes that gained or lost a benchmark)")
+	top := flags.Int("top", 10, "number of zip codes per state in the movers report")
+	flags.Parse(args)
+
+	if *oldZips == "" || *oldPlans == "" {
+		return fmt.Errorf("usage: slcsp compare -old-zips zips.csv -old-plans plans.csv [-new-zips zips.csv] [-new-plans plans.csv]")
+	}
+
+	ctx := context.Background()
+	before, err := resolver.Load(ctx, source.Files{Zips: *oldZips, Plans: *oldPlans})
+	if err != nil {
+		return err
+	}
+	after, err := resolver.Load(ctx, source.Files{Zips: *newZips, Plans: *newPlans})
+	if err != nil {
+		return err
+	}
+
+	changes := compareResolvers(before, after)
+	switch *report {
+	case "zips":
+		return writeChanges(os.Stdout, changes)
+	case "movers":
+		return writeChanges(os.Stdout, biggestMovers(changes, *top))
+	case "coverage":
+		coverage := make([]ZipChange, 0)
+		for _, change := range changes {
+			if status := change.Status(); status == StatusGained || status == StatusLost {
+				coverage = append(coverage, change)
+			}
+		}
+		return writeChanges(os.Stdout, coverage)
+	default:
+		return fmt.Errorf("unknown report %q, expected zips, movers or coverage", *report)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+
+	"slcsp/model"
+)
+
+// standardVariant is the CSR variant of a plan without cost-sharing reductions
+const standardVariant = "01"
+
+// checkCSRMode returns an error unless mode is a valid -csr mode
+func checkCSRMode(mode string) error {
+	isVariant := len(mode) == 2 && mode[0] >= '0' && mode[0] <= '9' && mode[1] >= '0' && mode[1] <= '9'
+	if mode != "" && mode != "collapse" && !isVariant {
+		return fmt.Errorf("unknown -csr %q, expected collapse or a two digit variant such as 01", mode)
+	}
+	return nil
+}
+
+// csrVariants applies a -csr mode to plans whose IDs carry cost-sharing reduction variant suffixes
+// "collapse" keeps one row per base plan and rate area, the standard variant if there is one and otherwise
+// the lowest numbered; a variant number such as "04" keeps only that variant; "" keeps every row
+// Plans without a variant suffix are always kept
+func csrVariants(plans []model.Plan, mode string) ([]model.Plan, error) {
+	if err := checkCSRMode(mode); err != nil {
+		return nil, err
+	}
+
+	switch mode {
+	case "":
+		return plans, nil
+	case "collapse":
+		chosen := make(map[planKey]int)
+		kept := make([]model.Plan, 0, len(plans))
+		for _, plan := range plans {
+			base, variant := plan.Variant()
+			if variant == "" {
+				kept = append(kept, plan)
+				continue
+			}
+			key := planKey{base, plan.RateArea}
+			i, exists := chosen[key]
+			if !exists {
+				chosen[key] = len(kept)
+				kept = append(kept, plan)
+				continue
+			}
+			if _, keptVariant := kept[i].Variant(); keptVariant != standardVariant && (variant == standardVariant || variant < keptVariant) {
+				kept[i] = plan
+			}
+		}
+		return kept, nil
+	default:
+		kept := make([]model.Plan, 0, len(plans))
+		for _, plan := range plans {
+			if _, variant := plan.Variant(); variant == "" || variant == mode {
+				kept = append(kept, plan)
+			}
+		}
+		return kept, nil
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+)
+
+// demoFiles are the sample input files, built in so -demo works with no files at hand
+//
+//go:embed slcsp.csv zips.csv plans.csv
+var demoFiles embed.FS
+
+// openDemo opens input files from the built in samples
+func openDemo(name string) (fs.File, error) {
+	return demoFiles.Open(name)
+}
+
+// bakedDataset holds the zips.csv and plans.csv built into a binary made with -tags baked, or is nil
+var bakedDataset fs.FS
+
+// openBaked opens ZipsFileName and PlansFileName from bakedDataset, and any other input file with next
+func openBaked(next openFunc) openFunc {
+	return func(name string) (fs.File, error) {
+		if name == ZipsFileName || name == PlansFileName {
+			return bakedDataset.Open(name)
+		}
+		return next(name)
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	"slcsp/source"
+)
+
+// maxListedValues is the most distinct values a column can have and still have each value listed
+const maxListedValues = 10
+
+// ColumnDescription holds the statistics gathered for one column of a file
+// Type is the narrowest of "integer", "decimal" or "text" that fits every non-empty value
+// Values counts how many times each distinct value occurs
+type ColumnDescription struct {
+	Name   string
+	Type   string
+	Empty  int
+	Values map[string]int
+}
+
+// FileDescription holds what was detected about a delimited file
+type FileDescription struct {
+	Name      string
+	Delimiter rune
+	Rows      int
+	Columns   []*ColumnDescription
+}
+
+// valueType returns the narrowest type name that fits a non-empty value
+func valueType(value string) string {
+	if _, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return "integer"
+	}
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return "decimal"
+	}
+	return "text"
+}
+
+// widenType returns the type that fits values of both the current and the next type
+func widenType(current string, next string) string {
+	switch {
+	case current == "" || current == next:
+		return next
+	case current == "text" || next == "text":
+		return "text"
+	default:
+		return "decimal"
+	}
+}
+
+// describe reads a delimited file and gathers its delimiter, header names, column types and value counts
+// The first line is treated as the header
+func describe(name string, r io.Reader) (*FileDescription, error) {
+	// Peek at the first line to detect the delimiter without consuming it
+	buffered := bufio.NewReaderSize(r, 64*1024)
+	peeked, err := buffered.Peek(buffered.Size())
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, source.WrapReadError(name, err)
+	}
+	if i := bytes.IndexByte(peeked, '\n'); i >= 0 {
+		peeked = peeked[:i]
+	}
+
+	description := &FileDescription{Name: name, Delimiter: source.DetectDelimiter(peeked)}
+
+	reader := csv.NewReader(buffered)
+	reader.Comma = description.Delimiter
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return description, nil
+	}
+	if err != nil {
+		return nil, source.WrapReadError(name, err)
+	}
+	for _, columnName := range header {
+		description.Columns = append(description.Columns, &ColumnDescription{Name: columnName, Values: make(map[string]int)})
+	}
+
+	// Read file data
+	for {
+		record, err := reader.Read()
+
+		// Stop at end of file
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, source.WrapReadError(name, err)
+		}
+
+		description.Rows++
+		for i, value := range record {
+			// Ignore fields beyond the header, they have no column to belong to
+			if i >= len(description.Columns) {
+				break
+			}
+			column := description.Columns[i]
+			if value == "" {
+				column.Empty++
+				continue
+			}
+			column.Type = widenType(column.Type, valueType(value))
+			column.Values[value]++
+		}
+	}
+
+	return description, nil
+}
+
+// printDescription writes a FileDescription in a human readable layout
+func printDescription(w io.Writer, description *FileDescription) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "File:\t%s\n", description.Name)
+	fmt.Fprintf(tw, "Delimiter:\t%q\n", description.Delimiter)
+	fmt.Fprintf(tw, "Rows:\t%d\n", description.Rows)
+	fmt.Fprintf(tw, "Columns:\t%d\n", len(description.Columns))
+	fmt.Fprintln(tw)
+
+	fmt.Fprintln(tw, "column\ttype\tdistinct\tempty")
+	for _, column := range description.Columns {
+		columnType := column.Type
+		if columnType == "" {
+			columnType = "empty"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\n", column.Name, columnType, len(column.Values), column.Empty)
+	}
+
+	// List the values of low cardinality columns, most frequent first
+	for _, column := range description.Columns {
+		if len(column.Values) == 0 || len(column.Values) > maxListedValues {
+			continue
+		}
+		values := make([]string, 0, len(column.Values))
+		for value := range column.Values {
+			values = append(values, value)
+		}
+		sort.Slice(values, func(i, j int) bool {
+			if column.Values[values[i]] != column.Values[values[j]] {
+				return column.Values[values[i]] > column.Values[values[j]]
+			}
+			return values[i] < values[j]
+		})
+
+		fmt.Fprintln(tw)
+		fmt.Fprintf(tw, "%s values:\n", column.Name)
+		for _, value := range values {
+			fmt.Fprintf(tw, "  %s\t%d\n", value, column.Values[value])
+		}
+	}
+
+	return tw.Flush()
+}
+
+// runDescribe implements the `describe` command, printing a description of each named file
+func runDescribe(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: slcsp describe file.csv [file.csv ...]")
+	}
+
+	for i, name := range args {
+		file, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		description, err := describe(name, file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+
+		if i > 0 {
+			fmt.Println()
+		}
+		if err := printDescription(os.Stdout, description); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"slcsp/model"
+)
+
+// Modes of -duplicates: keep a row per occurrence of a repeated zip code, or only its first
+var duplicateModes = []string{"keep", "collapse"}
+
+// checkDuplicatesMode returns an error unless mode is a valid -duplicates mode
+func checkDuplicatesMode(mode string) error {
+	if !contains(duplicateModes, mode) {
+		return fmt.Errorf("unknown -duplicates %q, expected one of: %s", mode, strings.Join(duplicateModes, ", "))
+	}
+	return nil
+}
+
+// reportDuplicates logs a warning for each zip code that a query file has more than once, with the lines
+// it's on, returning how many zip codes are repeated
+func reportDuplicates(fileName string, results []model.Result, warnings *warningLog) int {
+	lines := make(map[string][]string)
+	order := make([]string, 0)
+	for _, result := range results {
+		if _, seen := lines[result.Zip]; !seen {
+			order = append(order, result.Zip)
+		}
+		lines[result.Zip] = append(lines[result.Zip], strconv.Itoa(result.Line))
+	}
+
+	repeated := 0
+	for _, zip := range order {
+		if len(lines[zip]) > 1 {
+			repeated++
+			warnings.warn(fileName+": duplicates", fmt.Sprintf("%s: zip code %s appears %d times, on lines %s", fileName, zip, len(lines[zip]), strings.Join(lines[zip], ", ")))
+		}
+	}
+	return repeated
+}
+
+// collapseDuplicates keeps the first occurrence of each zip code
+func collapseDuplicates(results []model.Result) []model.Result {
+	seen := make(map[string]bool, len(results))
+	kept := results[:0]
+	for _, result := range results {
+		if !seen[result.Zip] {
+			seen[result.Zip] = true
+			kept = append(kept, result)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"slcsp/source"
+)
+
+// ErrorSummary is a machine-readable record of the problems met while reading the input files
+// Complete is false if anything was skipped, meaning the results may be missing zip codes or plans
+// Problems can be added from several goroutines at once
+type ErrorSummary struct {
+	Complete bool           `json:"complete"`
+	Errors   []SummaryError `json:"errors"`
+	mu       sync.Mutex
+}
+
+// SummaryError is a single problem in an ErrorSummary
+// Line and Column are only set when the problem is with a particular record
+type SummaryError struct {
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+// Add records err in the summary and marks the summary incomplete
+func (s *ErrorSummary) Add(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Complete = false
+
+	var recordErr *source.RecordError
+	if errors.As(err, &recordErr) {
+		s.Errors = append(s.Errors, SummaryError{
+			File:    recordErr.File,
+			Line:    recordErr.Line,
+			Column:  recordErr.Column,
+			Message: recordErr.Err.Error(),
+		})
+		return
+	}
+	var limitErr *source.LimitError
+	if errors.As(err, &limitErr) {
+		s.Errors = append(s.Errors, SummaryError{
+			File:    limitErr.File,
+			Line:    limitErr.Line,
+			Message: fmt.Sprintf("exceeds the %s limit of %d", limitErr.Limit, limitErr.Max),
+		})
+		return
+	}
+	s.Errors = append(s.Errors, SummaryError{Message: err.Error()})
+}
+
+// Write writes the summary as JSON to the named file, or alongside the log (stderr unless -log-file is given) if no name is given
+func (s *ErrorSummary) Write(fileName string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if fileName == "" {
+		_, err = log.Writer().Write(data)
+		return err
+	}
+	return os.WriteFile(fileName, data, 0644)
+}
+
+// flattenErrors returns the errors joined in err by errors.Join, or err itself if it isn't joined
+func flattenErrors(err error) []error {
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return []error{err}
+	}
+	errs := make([]error, 0)
+	for _, e := range joined.Unwrap() {
+		errs = append(errs, flattenErrors(e)...)
+	}
+	return errs
+}
+
+// formatParseError describes an error reading the input files, listing several problems with records
+// under the file they're in with a count of them
+func formatParseError(err error) string {
+	errs := flattenErrors(err)
+	if len(errs) == 1 {
+		return errs[0].Error()
+	}
+
+	files := make([]string, 0)
+	byFile := make(map[string][]error)
+	for _, e := range errs {
+		file := ""
+		var recordErr *source.RecordError
+		if errors.As(e, &recordErr) {
+			file = recordErr.File
+		}
+		if _, seen := byFile[file]; !seen {
+			files = append(files, file)
+		}
+		byFile[file] = append(byFile[file], e)
+	}
+
+	var b strings.Builder
+	for _, file := range files {
+		if file != "" {
+			plural := "s"
+			if len(byFile[file]) == 1 {
+				plural = ""
+			}
+			fmt.Fprintf(&b, "\n%s: %d problem%s", file, len(byFile[file]), plural)
+		}
+		indent := "  "
+		if file == "" {
+			indent = ""
+		}
+		for _, e := range byFile[file] {
+			fmt.Fprintf(&b, "\n%s%v", indent, e)
+		}
+	}
+	return strings.TrimPrefix(b.String(), "\n")
+}
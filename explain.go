@@ -0,0 +1,129 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"slcsp/model"
+	"slcsp/resolver"
+	"slcsp/source"
+)
+
+// explainColumns are output columns describing the plan chosen as each benchmark: its ID, how many plans
+// share its rate, its issuer's name if a crosswalk of issuers is given, and each attribute of it if
+// attributes are given
+func explainColumns(r *resolver.Resolver, issuers map[string]string, attributes *model.PlanAttributes) []outputColumn {
+	// planValue is a value of a result's benchmark plan
+	planValue := func(result model.Result, value func(plan model.Plan, tied int) string) string {
+		if result.Rate == nil {
+			return ""
+		}
+		plan, tied, ok := r.BenchmarkPlan(result.RateArea)
+		if !ok {
+			return ""
+		}
+		return value(plan, tied)
+	}
+
+	columns := []outputColumn{
+		{
+			Name: "benchmark_plan_id",
+			Value: func(result model.Result) string {
+				return planValue(result, func(plan model.Plan, tied int) string { return plan.ID })
+			},
+		},
+		{
+			Name: "tied_plans",
+			Value: func(result model.Result) string {
+				return planValue(result, func(plan model.Plan, tied int) string { return strconv.Itoa(tied) })
+			},
+		},
+	}
+	if issuers != nil {
+		columns = append(columns, outputColumn{
+			Name: source.ColIssuerName,
+			Value: func(result model.Result) string {
+				return planValue(result, func(plan model.Plan, tied int) string { return issuers[plan.IssuerID()] })
+			},
+		})
+	}
+	if attributes == nil {
+		return columns
+	}
+
+	for i, name := range attributes.Columns {
+		// An issuer_name attribute gives way to the crosswalk's
+		if issuers != nil && name == source.ColIssuerName {
+			continue
+		}
+		i := i
+		columns = append(columns, outputColumn{
+			Name: name,
+			Value: func(result model.Result) string {
+				return planValue(result, func(plan model.Plan, tied int) string {
+					values, exists := attributes.Lookup(plan)
+					if !exists {
+						return ""
+					}
+					return values[i]
+				})
+			},
+		})
+	}
+	return columns
+}
+
+// ambiguousAreasColumn is an output column listing the rate areas of each ambiguous zip code, such as MO3|MO4
+func ambiguousAreasColumn(r *resolver.Resolver) outputColumn {
+	return outputColumn{
+		Name: "rate_areas",
+		Value: func(result model.Result) string {
+			if !result.Ambiguous {
+				return ""
+			}
+			rateAreas := r.RateAreas(result.Zip)
+			sort.Slice(rateAreas, func(i, j int) bool {
+				return rateAreas[i].Less(rateAreas[j])
+			})
+			values := make([]string, 0, len(rateAreas))
+			for _, rateArea := range rateAreas {
+				values = append(values, rateArea.State+rateArea.Code)
+			}
+			return strings.Join(values, "|")
+		},
+	}
+}
+
+// blankReasonColumn is an output column giving why each zip code has no rate: ambiguous, not_found,
+// no_plans, too_few_plans or suppressed
+func blankReasonColumn(r *resolver.Resolver, thin thinMarkets) outputColumn {
+	return outputColumn{
+		Name: "blank_reason",
+		Value: func(result model.Result) string {
+			return blankReason(r, result, thin)
+		},
+	}
+}
+
+// cheapestPlans gives the two cheapest Silver plans of each result's rate area, at its lowest and second
+// lowest rates, or none for a zip code that's ambiguous or not found
+func cheapestPlans(r *resolver.Resolver) func(result model.Result) []model.Plan {
+	return func(result model.Result) []model.Plan {
+		if result.Ambiguous || result.RateArea.IsZero() {
+			return nil
+		}
+		return r.CheapestPlans(result.RateArea, 2)
+	}
+}
+
+// allRates gives the rates each result's benchmark was chosen from, or none for a zip code that
+// isn't in a single rate area
+func allRates(r *resolver.Resolver) func(result model.Result) []float64 {
+	return func(result model.Result) []float64 {
+		if result.RateArea.IsZero() {
+			return nil
+		}
+		return r.SilverRates(result.RateArea)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+)
+
+// hashFunc returns the size and hash of an input file
+type hashFunc func(name string) (LockedFile, error)
+
+// isStream reports whether a named input is a FIFO, process substitution or other file that can only be
+// read once, rather than a regular file; names that aren't on disk, such as built in files, aren't streams
+func isStream(name string) bool {
+	info, err := os.Stat(name)
+	return err == nil && !info.Mode().IsRegular()
+}
+
+// readHashes records the hash of each input file as it's read, so that inputs that can only be read once
+// can still be checked against a dataset lock or described in metadata
+type readHashes struct {
+	mu    sync.Mutex
+	files map[string]LockedFile
+}
+
+// wrap returns an openFunc whose files are hashed as they're read
+func (h *readHashes) wrap(open openFunc) openFunc {
+	return func(name string) (fs.File, error) {
+		file, err := open(name)
+		if err != nil {
+			return nil, err
+		}
+		return &hashingFile{File: file, name: name, hash: sha256.New(), readHashes: h}, nil
+	}
+}
+
+// hash returns the hash of a file that's been read to the end
+func (h *readHashes) hash(name string) (LockedFile, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	locked, exists := h.files[name]
+	if !exists {
+		return LockedFile{}, fmt.Errorf("%s wasn't read in full, so it can't be hashed", name)
+	}
+	return locked, nil
+}
+
+// hashingFile is a file that records its hash in readHashes once it's read to the end
+type hashingFile struct {
+	fs.File
+	name       string
+	hash       hash.Hash
+	size       int64
+	readHashes *readHashes
+}
+
+func (f *hashingFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	f.hash.Write(p[:n])
+	f.size += int64(n)
+	if err == io.EOF {
+		f.readHashes.mu.Lock()
+		if f.readHashes.files == nil {
+			f.readHashes.files = make(map[string]LockedFile)
+		}
+		f.readHashes.files[f.name] = LockedFile{Name: f.name, Size: f.size, SHA256: hex.EncodeToString(f.hash.Sum(nil))}
+		f.readHashes.mu.Unlock()
+	}
+	return n, err
+}
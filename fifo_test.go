@@ -0,0 +1,123 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// buildTool builds the slcsp command into a temporary directory, returning its path
+func buildTool(t *testing.T) string {
+	t.Helper()
+	tool := filepath.Join(t.TempDir(), "slcsp")
+	if out, err := exec.Command("go", "build", "-o", tool, ".").CombinedOutput(); err != nil {
+		t.Fatalf("building slcsp: %v\n%s", err, out)
+	}
+	return tool
+}
+
+// inputDir returns a temporary directory with copies of the sample input files
+func inputDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, name := range []string{SlcspFileName, ZipsFileName, PlansFileName} {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// makeFIFO replaces a file of dir with a FIFO that a goroutine writes its contents to, once for each
+// reader, so a second read blocks rather than reading it again
+func makeFIFO(t *testing.T, dir string, name string) []byte {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Mkfifo(path, 0644); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		file, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if err != nil {
+			return
+		}
+		file.Write(data)
+		file.Close()
+	}()
+	return data
+}
+
+// runTool runs the tool in dir, failing the test if it doesn't finish promptly, as when it opens a FIFO twice
+func runTool(t *testing.T, tool string, dir string, args ...string) string {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, tool, args...)
+	cmd.Dir = dir
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if ctx.Err() != nil {
+		t.Fatalf("slcsp %s timed out, reading an input twice?", strings.Join(args, " "))
+	}
+	if err != nil {
+		t.Fatalf("slcsp %s: %v\n%s", strings.Join(args, " "), err, stderr.String())
+	}
+	return string(out)
+}
+
+// TestFIFOQueries checks a query file read from a FIFO gives the same results as a regular file
+func TestFIFOQueries(t *testing.T) {
+	tool := buildTool(t)
+	dir := inputDir(t)
+	want := runTool(t, tool, dir)
+
+	makeFIFO(t, dir, SlcspFileName)
+	if got := runTool(t, tool, dir); got != want {
+		t.Errorf("results from a FIFO query file differ from a regular file's:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+// TestFIFOMetadata checks -metadata hashes an input read from a FIFO as it's read, rather than opening it
+// again after, which blocked before inputs that can only be read once were hashed as they're read
+func TestFIFOMetadata(t *testing.T) {
+	tool := buildTool(t)
+	dir := inputDir(t)
+	want := runTool(t, tool, dir)
+
+	data := makeFIFO(t, dir, ZipsFileName)
+	got := runTool(t, tool, dir, "-metadata", "header")
+	sum := sha256.Sum256(data)
+	if line := "input: " + ZipsFileName + " sha256 " + hex.EncodeToString(sum[:]); !strings.Contains(got, line) {
+		t.Errorf("metadata of a FIFO input lacks %q:\n%s", line, got)
+	}
+	var results []string
+	for _, line := range strings.SplitAfter(got, "\n") {
+		if !strings.HasPrefix(line, "#") {
+			results = append(results, line)
+		}
+	}
+	if strings.Join(results, "") != want {
+		t.Errorf("results with a FIFO %s differ from a regular file's:\n%s\nwant:\n%s", ZipsFileName, got, want)
+	}
+}
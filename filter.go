@@ -0,0 +1,267 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+
+	"slcsp/model"
+)
+
+// filterType is the type of a value in a filter expression
+type filterType int
+
+const (
+	filterBool filterType = iota
+	filterNumber
+	filterString
+	filterNil
+)
+
+func (t filterType) String() string {
+	return [...]string{"bool", "number", "string", "nil"}[t]
+}
+
+// filterFields are the fields of a result a filter expression can use, and their types
+// rate is nil when the zip code has no benchmark
+var filterFields = map[string]filterType{
+	"zipcode":     filterString,
+	"rate":        filterNumber,
+	"state":       filterString,
+	"rate_area":   filterString,
+	"ambiguous":   filterBool,
+	"county_code": filterString,
+	"county_name": filterString,
+}
+
+// Filter is a parsed filter expression such as `rate > 300 && state == "KS"`
+// The syntax is a Go expression of literals, result fields, comparisons, !, && and ||
+type Filter struct {
+	expr ast.Expr
+}
+
+// parseFilter parses and type checks a filter expression
+func parseFilter(text string) (*Filter, error) {
+	expr, err := parser.ParseExpr(text)
+	if err != nil {
+		return nil, fmt.Errorf("filter %q: %w", text, err)
+	}
+	exprType, err := checkFilter(expr)
+	if err != nil {
+		return nil, fmt.Errorf("filter %q: %w", text, err)
+	}
+	if exprType != filterBool {
+		return nil, fmt.Errorf("filter %q is a %s, not a condition", text, exprType)
+	}
+	return &Filter{expr: expr}, nil
+}
+
+// checkFilter returns the type of a filter expression, or an error if it can't be evaluated
+func checkFilter(expr ast.Expr) (filterType, error) {
+	switch e := expr.(type) {
+	case *ast.ParenExpr:
+		return checkFilter(e.X)
+
+	case *ast.Ident:
+		switch e.Name {
+		case "true", "false":
+			return filterBool, nil
+		case "nil":
+			return filterNil, nil
+		}
+		if fieldType, exists := filterFields[e.Name]; exists {
+			return fieldType, nil
+		}
+		names := make([]string, 0, len(filterFields))
+		for name := range filterFields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return 0, fmt.Errorf("unknown field %q, expected one of: %s", e.Name, strings.Join(names, ", "))
+
+	case *ast.BasicLit:
+		switch e.Kind {
+		case token.INT, token.FLOAT:
+			// Go also allows literals such as 0x1F and 017, which ParseFloat reads as 0 or in decimal
+			_, err := strconv.ParseFloat(e.Value, 64)
+			octal := e.Kind == token.INT && len(e.Value) > 1 && e.Value[0] == '0'
+			if err != nil || octal {
+				return 0, fmt.Errorf("number %s isn't a plain decimal, such as 300 or 2.5e2", e.Value)
+			}
+			return filterNumber, nil
+		case token.STRING:
+			return filterString, nil
+		}
+
+	case *ast.UnaryExpr:
+		operandType, err := checkFilter(e.X)
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case e.Op == token.NOT && operandType == filterBool:
+			return filterBool, nil
+		case e.Op == token.SUB && operandType == filterNumber:
+			return filterNumber, nil
+		}
+		return 0, fmt.Errorf("can't apply %s to a %s", e.Op, operandType)
+
+	case *ast.BinaryExpr:
+		left, err := checkFilter(e.X)
+		if err != nil {
+			return 0, err
+		}
+		right, err := checkFilter(e.Y)
+		if err != nil {
+			return 0, err
+		}
+		switch e.Op {
+		case token.LAND, token.LOR:
+			if left != filterBool || right != filterBool {
+				return 0, fmt.Errorf("%s needs conditions on both sides, not a %s and a %s", e.Op, left, right)
+			}
+			return filterBool, nil
+		case token.EQL, token.NEQ:
+			// Only a rate can be compared with nil
+			if left == right || (left == filterNil && right == filterNumber) || (left == filterNumber && right == filterNil) {
+				return filterBool, nil
+			}
+		case token.LSS, token.LEQ, token.GTR, token.GEQ:
+			if left == right && (left == filterNumber || left == filterString) {
+				return filterBool, nil
+			}
+		default:
+			return 0, fmt.Errorf("unsupported operator %s", e.Op)
+		}
+		return 0, fmt.Errorf("can't compare a %s with a %s using %s", left, right, e.Op)
+	}
+
+	return 0, fmt.Errorf("unsupported expression at offset %d", expr.Pos()-1)
+}
+
+// Match reports whether the filter expression holds for a result
+func (f *Filter) Match(result model.Result) bool {
+	return evalFilter(f.expr, result).(bool)
+}
+
+// evalFilter evaluates a type checked filter expression for a result
+// Values are bool, float64, string or nil
+func evalFilter(expr ast.Expr, result model.Result) interface{} {
+	switch e := expr.(type) {
+	case *ast.ParenExpr:
+		return evalFilter(e.X, result)
+
+	case *ast.Ident:
+		switch e.Name {
+		case "true":
+			return true
+		case "false":
+			return false
+		case "nil":
+			return nil
+		}
+		return filterField(e.Name, result)
+
+	case *ast.BasicLit:
+		if e.Kind == token.STRING {
+			value, _ := strconv.Unquote(e.Value)
+			return value
+		}
+		// checkFilter has made sure the number parses
+		value, _ := strconv.ParseFloat(e.Value, 64)
+		return value
+
+	case *ast.UnaryExpr:
+		operand := evalFilter(e.X, result)
+		if e.Op == token.NOT {
+			return !operand.(bool)
+		}
+		if operand == nil {
+			return nil
+		}
+		return -operand.(float64)
+
+	case *ast.BinaryExpr:
+		// && and || only evaluate their right side when needed
+		switch e.Op {
+		case token.LAND:
+			return evalFilter(e.X, result).(bool) && evalFilter(e.Y, result).(bool)
+		case token.LOR:
+			return evalFilter(e.X, result).(bool) || evalFilter(e.Y, result).(bool)
+		}
+		return compareFilterValues(evalFilter(e.X, result), evalFilter(e.Y, result), e.Op)
+	}
+
+	panic(fmt.Sprintf("unchecked filter expression %T", expr))
+}
+
+// filterField returns the value of a result's field
+func filterField(name string, result model.Result) interface{} {
+	switch name {
+	case "zipcode":
+		return result.Zip
+	case "rate":
+		if result.Rate == nil {
+			return nil
+		}
+		return *result.Rate
+	case "state":
+		return result.RateArea.State
+	case "rate_area":
+		return result.RateArea.Code
+	case "ambiguous":
+		return result.Ambiguous
+	case "county_code":
+		return joinCounties(result.Counties, countyCode)
+	case "county_name":
+		return joinCounties(result.Counties, countyName)
+	}
+	panic("unknown filter field " + name)
+}
+
+// compareFilterValues compares two values of the same type
+// A missing rate only equals nil, so any ordering comparison with it is false
+func compareFilterValues(left interface{}, right interface{}, op token.Token) bool {
+	if left == nil || right == nil {
+		switch op {
+		case token.EQL:
+			return left == right
+		case token.NEQ:
+			return left != right
+		}
+		return false
+	}
+
+	switch l := left.(type) {
+	case float64:
+		return compareOrdered(l < right.(float64), l == right.(float64), op)
+	case string:
+		return compareOrdered(l < right.(string), l == right.(string), op)
+	case bool:
+		return (l == right.(bool)) == (op == token.EQL)
+	}
+	return false
+}
+
+// compareOrdered applies a comparison operator given whether the left side is less than or equal to the right
+func compareOrdered(less bool, equal bool, op token.Token) bool {
+	switch op {
+	case token.EQL:
+		return equal
+	case token.NEQ:
+		return !equal
+	case token.LSS:
+		return less
+	case token.LEQ:
+		return less || equal
+	case token.GTR:
+		return !less && !equal
+	case token.GEQ:
+		return !less
+	}
+	return false
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+
+	"slcsp/model"
+)
+
+// TestFilterNumbers checks numbers in a filter are read in decimal, and that hex, octal and binary literals
+// are rejected rather than compared as 0 or misread
+func TestFilterNumbers(t *testing.T) {
+	rate := 300.0
+	result := model.Result{Zip: "64148", Rate: &rate}
+	for _, text := range []string{"rate == 300", "rate == 300.0", "rate == 3e2", "rate > -1.5", "rate < 1_000", "rate > 0"} {
+		filter, err := parseFilter(text)
+		if err != nil {
+			t.Errorf("filter %q: %v", text, err)
+			continue
+		}
+		if !filter.Match(result) {
+			t.Errorf("filter %q doesn't match a rate of 300", text)
+		}
+	}
+	for _, text := range []string{"rate > 0x1F", "rate > 017", "rate > 0o17", "rate > 0b101", "rate > 1e400"} {
+		if _, err := parseFilter(text); err == nil {
+			t.Errorf("filter %q parsed, want an error for its number", text)
+		}
+	}
+}
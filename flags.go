@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"slcsp/source"
+)
+
+// columnsFlag is a flag.Value for mapping column names, e.g. `rate=premium,metal_level=tier`
+// Each pair gives the column's usual name from layout and the name it has in the file instead
+type columnsFlag struct {
+	columns *map[string]string
+	layout  []string
+}
+
+func (f *columnsFlag) String() string {
+	if f == nil || f.columns == nil {
+		return ""
+	}
+	pairs := make([]string, 0, len(*f.columns))
+	for _, column := range f.layout {
+		if name, exists := (*f.columns)[column]; exists {
+			pairs = append(pairs, column+"="+name)
+		}
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (f *columnsFlag) Set(value string) error {
+	if *f.columns == nil {
+		*f.columns = make(map[string]string)
+	}
+
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("%q should be in the form column=name", pair)
+		}
+
+		column := strings.TrimSpace(parts[0])
+		if !contains(f.layout, column) {
+			return fmt.Errorf("unknown column %q, expected one of: %s", column, strings.Join(f.layout, ", "))
+		}
+		(*f.columns)[column] = strings.TrimSpace(parts[1])
+	}
+
+	return nil
+}
+
+// pairsFlag is a repeatable flag.Value for name=value pairs, e.g. `plans.csv=https://example.com/plans.zip`
+type pairsFlag map[string]string
+
+func (f pairsFlag) String() string {
+	pairs := make([]string, 0, len(f))
+	for name, value := range f {
+		pairs = append(pairs, name+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (f pairsFlag) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("%q should be in the form name=value", value)
+	}
+	f[parts[0]] = parts[1]
+	return nil
+}
+
+// contains reports whether value is one of values
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// labeledDataset is a zips and plans file pair given a label such as its plan year
+type labeledDataset struct {
+	Label string
+	Files source.Files
+}
+
+// datasetsFlag is a repeatable flag.Value for labeled datasets, e.g. `2024=zips.csv,plans.csv`
+type datasetsFlag []labeledDataset
+
+func (f *datasetsFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	values := make([]string, 0, len(*f))
+	for _, dataset := range *f {
+		values = append(values, dataset.Label+"="+dataset.Files.Zips+","+dataset.Files.Plans)
+	}
+	return strings.Join(values, " ")
+}
+
+func (f *datasetsFlag) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return fmt.Errorf("%q should be in the form label=zips.csv,plans.csv", value)
+	}
+	files := strings.Split(parts[1], ",")
+	if len(files) != 2 || files[0] == "" || files[1] == "" {
+		return fmt.Errorf("%q should be in the form label=zips.csv,plans.csv", value)
+	}
+	for _, dataset := range *f {
+		if dataset.Label == parts[0] {
+			return fmt.Errorf("dataset %q given more than once", parts[0])
+		}
+	}
+
+	*f = append(*f, labeledDataset{Label: parts[0], Files: source.Files{Zips: files[0], Plans: files[1]}})
+	return nil
+}
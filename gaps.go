@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"os"
+	"strconv"
+
+	"slcsp/resolver"
+	"slcsp/source"
+)
+
+// runGaps implements the `gaps` command, reporting rate areas with too few Silver plans for a benchmark
+// There is one row per zip code in each such rate area, or a single row with no zip code if it has none
+func runGaps(args []string) error {
+	flags := flag.NewFlagSet("gaps", flag.ExitOnError)
+	zips := flags.String("zips", ZipsFileName, "zips file to read")
+	plans := flags.String("plans", PlansFileName, "plans file to read")
+	flags.Parse(args)
+
+	r, err := resolver.Load(context.Background(), source.Files{Zips: *zips, Plans: *plans})
+	if err != nil {
+		return err
+	}
+
+	zipsByArea := zipsByRateArea(r)
+
+	writer := csv.NewWriter(os.Stdout)
+	writer.Write([]string{"state", "rate_area", "plans", "silver_plans", "zipcode"})
+	for _, summary := range r.RateAreaSummaries() {
+		if summary.SilverPlans >= 2 {
+			continue
+		}
+
+		record := []string{
+			summary.RateArea.State,
+			summary.RateArea.Code,
+			strconv.Itoa(summary.Plans),
+			strconv.Itoa(summary.SilverPlans),
+			"",
+		}
+		areaZips := zipsByArea[summary.RateArea]
+		if len(areaZips) == 0 {
+			writer.Write(record)
+			continue
+		}
+		for _, zip := range areaZips {
+			record[4] = zip
+			writer.Write(record)
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
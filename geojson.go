@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"slcsp/model"
+	"slcsp/resolver"
+	"slcsp/source"
+)
+
+// zctaProperties are the feature properties checked, in order, for a feature's zip code
+// They cover the Census ZCTA boundary files as well as plainer exports
+var zctaProperties = []string{"ZCTA5CE20", "ZCTA5CE10", "GEOID20", "GEOID10", "zipcode", "zip", "ZIP"}
+
+// FeatureCollection is a GeoJSON FeatureCollection
+// Geometry and any members other than the properties are passed through untouched
+type FeatureCollection struct {
+	Type     string    `json:"type"`
+	Features []Feature `json:"features"`
+}
+
+// Feature is a GeoJSON Feature
+type Feature struct {
+	Type       string                 `json:"type"`
+	ID         json.RawMessage        `json:"id,omitempty"`
+	Properties map[string]interface{} `json:"properties"`
+	Geometry   json.RawMessage        `json:"geometry"`
+}
+
+// featureZip returns the zip code of a feature, taken from the named property or the first of zctaProperties found
+func featureZip(feature Feature, property string) string {
+	properties := zctaProperties
+	if property != "" {
+		properties = []string{property}
+	}
+	for _, name := range properties {
+		if value, exists := feature.Properties[name]; exists {
+			return fmt.Sprint(value)
+		}
+	}
+	return ""
+}
+
+// runExport implements the `export` command; `export geojson` attaches the benchmark of each zip code
+// to its polygon in a ZCTA boundary GeoJSON file, and `export joined` writes the joined input files
+func runExport(args []string) error {
+	usage := fmt.Errorf("usage: slcsp export geojson -zcta zcta.geojson | slcsp export joined")
+	if len(args) == 0 {
+		return usage
+	}
+	switch args[0] {
+	case "joined", "-joined", "--joined":
+		return runExportJoined(args[1:])
+	case "geojson":
+	default:
+		return usage
+	}
+
+	flags := flag.NewFlagSet("export geojson", flag.ExitOnError)
+	zcta := flags.String("zcta", "", "GeoJSON FeatureCollection of zip code (ZCTA) boundaries")
+	zipProperty := flags.String("zip-property", "", "feature property holding the zip code (default: the first of "+fmt.Sprint(zctaProperties)+" found)")
+	zips := flags.String("zips", ZipsFileName, "zips file to read")
+	plans := flags.String("plans", PlansFileName, "plans file to read")
+	flags.Parse(args[1:])
+
+	if *zcta == "" {
+		return fmt.Errorf("usage: slcsp export geojson -zcta zcta.geojson")
+	}
+
+	r, err := resolver.Load(context.Background(), source.Files{Zips: *zips, Plans: *plans})
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(*zcta)
+	if err != nil {
+		return err
+	}
+	var collection FeatureCollection
+	if err := json.Unmarshal(data, &collection); err != nil {
+		return fmt.Errorf("%s: %w", *zcta, err)
+	}
+
+	// Add the benchmark and rate area to every feature, leaving them null where there isn't one
+	for i := range collection.Features {
+		feature := &collection.Features[i]
+		if feature.Properties == nil {
+			feature.Properties = make(map[string]interface{})
+		}
+		result := r.Lookup(featureZip(*feature, *zipProperty))
+		feature.Properties["slcsp"] = result.Rate
+		feature.Properties["ambiguous"] = result.Ambiguous
+		feature.Properties["rate_area"] = nil
+		if !result.RateArea.IsZero() {
+			feature.Properties["rate_area"] = result.RateArea.String()
+		}
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	return encoder.Encode(collection)
+}
+
+// runExportJoined implements `export joined`, writing a row for every plan of every zip code's rate area
+// as CSV, so the inputs can be loaded into a BI tool as one table without redoing the join
+// A zip code whose rate area has no plans still gets a row, with the plan columns empty
+func runExportJoined(args []string) error {
+	flags := flag.NewFlagSet("export joined", flag.ExitOnError)
+	queries := flags.String("slcsp", "", "only export the zip codes of this query file, rather than all of them")
+	zips := flags.String("zips", ZipsFileName, "zips file to read")
+	plans := flags.String("plans", PlansFileName, "plans file to read")
+	flags.Parse(args)
+
+	var zipsOpts source.Options
+	if *queries != "" {
+		results, err := source.ReadQueriesFile(*queries, source.Options{})
+		if err != nil {
+			return err
+		}
+		queried := make([]string, 0, len(results))
+		for _, result := range results {
+			queried = append(queried, result.Zip)
+		}
+		zipsOpts.Zips = source.NewZipFilter(queried)
+	}
+	zipMappings, err := source.ReadZipsFile(*zips, zipsOpts)
+	if err != nil {
+		return err
+	}
+	planRows, err := source.ReadPlansFile(*plans, source.Options{RateAreas: zipRateAreas(zipMappings)})
+	if err != nil {
+		return err
+	}
+	plansByArea := make(map[model.RateArea][]model.Plan)
+	for _, plan := range planRows {
+		plansByArea[plan.RateArea] = append(plansByArea[plan.RateArea], plan)
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"zipcode", "state", "county_code", "county_name", "rate_area", "plan_id", "metal_level", "rate"})
+	for _, zip := range zipMappings {
+		row := []string{zip.Zip, zip.RateArea.State, zip.CountyCode, zip.CountyName, zip.RateArea.Code}
+		areaPlans := plansByArea[zip.RateArea]
+		if len(areaPlans) == 0 {
+			writer.Write(append(row, "", "", ""))
+			continue
+		}
+		for _, plan := range areaPlans {
+			writer.Write(append(row, plan.ID, plan.MetalLevel, strconv.FormatFloat(plan.Rate, 'f', -1, 64)))
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	return w.Flush()
+}
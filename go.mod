@@ -1,3 +1,3 @@
 module slcsp
 
-go 1.15
+go 1.23
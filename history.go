@@ -0,0 +1,283 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"slcsp/model"
+	"slcsp/source"
+)
+
+// DefaultHistoryDir is the results store -store and `slcsp history` use by default
+const DefaultHistoryDir = "history"
+
+// storedRunLayout names each run in a results store by when it was made, in UTC, so names sort by time
+// The time is to the nanosecond, so runs made in the same second don't collide
+const storedRunLayout = "2006-01-02T150405.000000000Z"
+
+// secondsRunLayout is how runs were named to the second, before storedRunLayout; they're still read
+const secondsRunLayout = "2006-01-02T150405Z"
+
+// storedRun is a set of results in a results store
+type storedRun struct {
+	At   time.Time
+	File string
+}
+
+// storeResults adds the results of a run made at the given time to the store in dir, as a CSV of
+// zipcode and rate, creating the store if it doesn't exist
+// The first result is kept for a zip code given more than once
+func storeResults(dir string, at time.Time, batches []queryBatch) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	fileName := filepath.Join(dir, at.UTC().Format(storedRunLayout)+".csv")
+	file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(file)
+	writer.Write([]string{source.ColZipcode, "rate"})
+	seen := make(map[string]bool)
+	for _, batch := range batches {
+		for _, result := range batch.Results {
+			if !seen[result.Zip] {
+				seen[result.Zip] = true
+				writer.Write([]string{result.Zip, formatRate(result.Rate)})
+			}
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// storedRuns lists the runs in the store in dir, oldest first, ignoring files not named like one
+func storedRuns(dir string) ([]storedRun, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	runs := make([]storedRun, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || filepath.Ext(name) != ".csv" {
+			continue
+		}
+		at, err := time.Parse(storedRunLayout, name[:len(name)-len(".csv")])
+		if err != nil {
+			if at, err = time.Parse(secondsRunLayout, name[:len(name)-len(".csv")]); err != nil {
+				continue
+			}
+		}
+		runs = append(runs, storedRun{At: at, File: filepath.Join(dir, name)})
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].At.Before(runs[j].At) })
+	return runs, nil
+}
+
+// resultColumns finds the zipcode and rate columns in the header of a results file
+func resultColumns(fileName string, header []string) (zipColumn int, rateColumn int, err error) {
+	zipColumn, rateColumn = -1, -1
+	for i, column := range header {
+		switch column {
+		case source.ColZipcode:
+			zipColumn = i
+		case "rate":
+			rateColumn = i
+		}
+	}
+	if zipColumn < 0 || rateColumn < 0 {
+		return 0, 0, fmt.Errorf("%s: expected %s and rate columns", fileName, source.ColZipcode)
+	}
+	return zipColumn, rateColumn, nil
+}
+
+// storedRate finds a zip code's rate in a stored run, or in any results file with zipcode and rate
+// columns, skipping comment lines such as those of -metadata
+// found is false if the zip code isn't in the file; rate is nil if it's there without a rate
+func storedRate(fileName string, zip string) (rate *float64, found bool, err error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, false, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, false, source.WrapReadError(fileName, err)
+	}
+	zipColumn, rateColumn, err := resultColumns(fileName, header)
+	if err != nil {
+		return nil, false, err
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil, false, nil
+		}
+		if err != nil {
+			return nil, false, source.WrapReadError(fileName, err)
+		}
+		if len(record) <= max(zipColumn, rateColumn) || record[zipColumn] != zip {
+			continue
+		}
+		if record[rateColumn] == "" {
+			return nil, true, nil
+		}
+		value, err := strconv.ParseFloat(record[rateColumn], 64)
+		if err != nil {
+			return nil, false, fmt.Errorf("%s: zip code %s has rate %q", fileName, zip, record[rateColumn])
+		}
+		return &value, true, nil
+	}
+}
+
+// runHistory implements the `history` command, showing how a zip code's benchmark changed across the
+// runs in a results store, or what it was on a date, and `history add`, which stores archived results
+func runHistory(args []string) error {
+	if len(args) > 0 && args[0] == "add" {
+		return runHistoryAdd(args[1:])
+	}
+
+	flags := flag.NewFlagSet("history", flag.ExitOnError)
+	dir := flags.String("store", DefaultHistoryDir, "results store to read, as written by -store")
+	asOf := flags.String("as-of", "", "only show the benchmark of the last run on or before this date, e.g. 2025-03-01")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: slcsp history [-store %s] [-as-of date] zipcode | slcsp history add [-store %s] -date date results.csv\n", DefaultHistoryDir, DefaultHistoryDir)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("expected one zip code")
+	}
+	zip := flags.Arg(0)
+
+	runs, err := storedRuns(*dir)
+	if err != nil {
+		return err
+	}
+	if *asOf != "" {
+		date, err := time.Parse(source.DateLayout, *asOf)
+		if err != nil {
+			return fmt.Errorf("-as-of: %w", err)
+		}
+		// Runs made any time on the date count
+		end := date.AddDate(0, 0, 1)
+		last := -1
+		for i, run := range runs {
+			if run.At.Before(end) {
+				last = i
+			}
+		}
+		if last < 0 {
+			return fmt.Errorf("no runs in %s on or before %s", *dir, *asOf)
+		}
+		runs = runs[last : last+1]
+	}
+
+	// A run is listed with its rate, and how much that changed since the previous run with the zip code
+	writer := csv.NewWriter(os.Stdout)
+	writer.Write([]string{"run", "rate", "change"})
+	var previous *float64
+	listed := false
+	for _, run := range runs {
+		rate, found, err := storedRate(run.File, zip)
+		if err != nil {
+			return err
+		}
+		if !found {
+			continue
+		}
+		change := ""
+		if listed && rate != nil && previous != nil && *rate != *previous {
+			change = fmt.Sprintf("%+.2f", *rate-*previous)
+		} else if listed && (rate == nil) != (previous == nil) {
+			change = "changed"
+		}
+		writer.Write([]string{run.At.Format(time.RFC3339Nano), formatRate(rate), change})
+		previous, listed = rate, true
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	if !listed {
+		return fmt.Errorf("zip code %s isn't in any run in %s", zip, *dir)
+	}
+	return nil
+}
+
+// runHistoryAdd implements `history add`, adding a results file from before there was a store to it,
+// dated as given
+func runHistoryAdd(args []string) error {
+	flags := flag.NewFlagSet("history add", flag.ExitOnError)
+	dir := flags.String("store", DefaultHistoryDir, "results store to add to")
+	date := flags.String("date", "", "date the results are from, e.g. 2025-03-01, or a time such as 2025-03-01T09:30:00Z")
+	flags.Parse(args)
+	if flags.NArg() != 1 || *date == "" {
+		return fmt.Errorf("usage: slcsp history add [-store %s] -date 2025-03-01 results.csv", DefaultHistoryDir)
+	}
+
+	at, err := time.Parse(time.RFC3339, *date)
+	if err != nil {
+		if at, err = time.Parse(source.DateLayout, *date); err != nil {
+			return fmt.Errorf("-date: %w", err)
+		}
+	}
+
+	// Only the zip codes and rates are stored, the same as for a run
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return source.WrapReadError(flags.Arg(0), err)
+	}
+	if len(records) == 0 {
+		return &source.NoDataError{File: flags.Arg(0)}
+	}
+	zipColumn, rateColumn, err := resultColumns(flags.Arg(0), records[0])
+	if err != nil {
+		return err
+	}
+
+	results := make([]model.Result, 0, len(records)-1)
+	for line, record := range records[1:] {
+		if len(record) <= max(zipColumn, rateColumn) {
+			continue
+		}
+		result := model.Result{Zip: record[zipColumn]}
+		if record[rateColumn] != "" {
+			rate, err := strconv.ParseFloat(record[rateColumn], 64)
+			if err != nil {
+				return fmt.Errorf("%s: record %d has rate %q", flags.Arg(0), line+1, record[rateColumn])
+			}
+			result.Rate = &rate
+		}
+		results = append(results, result)
+	}
+	return storeResults(*dir, at, []queryBatch{{Input: flags.Arg(0), Results: results}})
+}
@@ -0,0 +1,55 @@
+// Package index reads and writes a compact, versioned on-disk index of zip code rate areas and
+// Silver plan rates, so lookups can be answered without parsing the CSV files
+//
+// An index file is little-endian and laid out as:
+//
+//	header     magic "SLCSPIDX", major uint16, minor uint16, section count uint32
+//	directory  per section: tag [4]byte, offset uint64, length uint64
+//	sections   the section payloads, at the offsets given in the directory
+//
+// The sections are tables of fixed-size records so they can be searched in place:
+//
+//	AREA  rate areas: state [8]byte, code [8]byte, first rate uint32, rate count uint32
+//	RATE  the Silver plan rates of every rate area, one for each plan, sorted least to greatest within each: float64
+//	ZIPS  zip codes sorted by zip code: zip [12]byte, first area uint32, area count uint32
+//	ZARE  rate area numbers referenced by ZIPS: uint32
+//
+// Strings are padded with NUL bytes to their field size. A reader accepts any file with the same
+// major version, skipping sections it doesn't know, so adding sections only needs a minor version
+// bump; changing the layout of an existing section needs a major version bump
+package index
+
+import "encoding/binary"
+
+// Magic starts every index file
+const Magic = "SLCSPIDX"
+
+// Version of the format written by this package
+const (
+	MajorVersion = 2
+	MinorVersion = 0
+)
+
+// Section tags
+const (
+	tagAreas     = "AREA"
+	tagRates     = "RATE"
+	tagZips      = "ZIPS"
+	tagZipAreas  = "ZARE"
+	headerSize   = len(Magic) + 2 + 2 + 4
+	dirEntrySize = 4 + 8 + 8
+)
+
+// Field and record sizes of the section tables
+const (
+	stateSize       = 8
+	codeSize        = 8
+	zipSize         = 12
+	areaRecordSize  = stateSize + codeSize + 4 + 4
+	rateRecordSize  = 8
+	zipRecordSize   = zipSize + 4 + 4
+	zipAreaItemSize = 4
+)
+
+// byteOrder is the byte order of every number in an index file
+var byteOrder = binary.LittleEndian
@@ -0,0 +1,228 @@
+package index
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+
+	"slcsp/model"
+)
+
+// VersionError is returned for an index file written in a major version this package can't read
+type VersionError struct {
+	Major int
+	Minor int
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("index format version %d.%d is not supported, expected major version %d", e.Major, e.Minor, MajorVersion)
+}
+
+// Index answers SLCSP lookups from the contents of an index file
+// It only ever reads its data, so an Index is safe to use from many goroutines at once
+type Index struct {
+	Major int
+	Minor int
+
+	areas    []byte
+	rates    []byte
+	zips     []byte
+	zipAreas []byte
+
+	// unmap releases the memory mapping the index was opened from, if any
+	unmap func() error
+}
+
+// Open memory-maps an index file so lookups read the file's pages directly,
+// without decoding the index into heap objects first
+// The Index must be closed when no longer needed, after which it can't be used
+func Open(fileName string) (*Index, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	// The mapping stays valid once the file is closed
+	defer file.Close()
+
+	data, unmap, err := mapFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fileName, err)
+	}
+	idx, err := Parse(data)
+	if err != nil {
+		unmap()
+		return nil, fmt.Errorf("%s: %w", fileName, err)
+	}
+	idx.unmap = unmap
+	return idx, nil
+}
+
+// Close releases the memory mapping of an Index opened with Open
+func (idx *Index) Close() error {
+	if idx.unmap == nil {
+		return nil
+	}
+	err := idx.unmap()
+	idx.unmap = nil
+	return err
+}
+
+// Read reads a whole index file into memory
+func Read(r io.Reader) (*Index, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse checks the header of an index file's contents and locates its sections
+// The Index refers to data rather than copying it, so data mustn't be modified afterwards
+func Parse(data []byte) (*Index, error) {
+	if len(data) < headerSize || string(data[:len(Magic)]) != Magic {
+		return nil, fmt.Errorf("not an index file")
+	}
+
+	idx := &Index{
+		Major: int(byteOrder.Uint16(data[len(Magic):])),
+		Minor: int(byteOrder.Uint16(data[len(Magic)+2:])),
+	}
+	if idx.Major != MajorVersion {
+		return nil, &VersionError{Major: idx.Major, Minor: idx.Minor}
+	}
+
+	sectionCount := int(byteOrder.Uint32(data[len(Magic)+4:]))
+	if len(data) < headerSize+sectionCount*dirEntrySize {
+		return nil, fmt.Errorf("index file is truncated")
+	}
+	for i := 0; i < sectionCount; i++ {
+		entry := data[headerSize+i*dirEntrySize:]
+		tag := string(entry[:4])
+		offset := byteOrder.Uint64(entry[4:])
+		length := byteOrder.Uint64(entry[12:])
+		if offset > uint64(len(data)) || length > uint64(len(data))-offset {
+			return nil, fmt.Errorf("index file is truncated")
+		}
+		payload := data[offset : offset+length]
+
+		// Sections from newer minor versions are skipped
+		switch tag {
+		case tagAreas:
+			idx.areas = payload
+		case tagRates:
+			idx.rates = payload
+		case tagZips:
+			idx.zips = payload
+		case tagZipAreas:
+			idx.zipAreas = payload
+		}
+	}
+
+	for tag, payload := range map[string][]byte{tagAreas: idx.areas, tagRates: idx.rates, tagZips: idx.zips, tagZipAreas: idx.zipAreas} {
+		if payload == nil {
+			return nil, fmt.Errorf("index file has no %s section", tag)
+		}
+	}
+	if len(idx.areas)%areaRecordSize != 0 || len(idx.rates)%rateRecordSize != 0 ||
+		len(idx.zips)%zipRecordSize != 0 || len(idx.zipAreas)%zipAreaItemSize != 0 {
+		return nil, fmt.Errorf("index file has a malformed section")
+	}
+
+	return idx, nil
+}
+
+// trimField returns a NUL padded string field without its padding
+func trimField(field []byte) []byte {
+	if i := bytes.IndexByte(field, 0); i >= 0 {
+		return field[:i]
+	}
+	return field
+}
+
+// getString reads a NUL padded string field
+func getString(field []byte) string {
+	return string(trimField(field))
+}
+
+// ZipCount returns the number of zip codes in the index
+func (idx *Index) ZipCount() int {
+	return len(idx.zips) / zipRecordSize
+}
+
+// RateAreaCount returns the number of rate areas in the index
+func (idx *Index) RateAreaCount() int {
+	return len(idx.areas) / areaRecordSize
+}
+
+// zipRecord returns the i'th record of the ZIPS section
+func (idx *Index) zipRecord(i int) []byte {
+	return idx.zips[i*zipRecordSize : (i+1)*zipRecordSize]
+}
+
+// rateArea returns the rate area with the given number and the range of its rates in the RATE section
+func (idx *Index) rateArea(number uint32) (model.RateArea, uint32, uint32, error) {
+	if int(number) >= idx.RateAreaCount() {
+		return model.RateArea{}, 0, 0, fmt.Errorf("index refers to missing rate area %d", number)
+	}
+	record := idx.areas[int(number)*areaRecordSize:]
+	rateArea := model.RateArea{
+		State: getString(record[:stateSize]),
+		Code:  getString(record[stateSize : stateSize+codeSize]),
+	}
+	return rateArea, byteOrder.Uint32(record[stateSize+codeSize:]), byteOrder.Uint32(record[stateSize+codeSize+4:]), nil
+}
+
+// rate returns the i'th rate of the RATE section
+func (idx *Index) rate(i uint32) float64 {
+	return math.Float64frombits(byteOrder.Uint64(idx.rates[int(i)*rateRecordSize:]))
+}
+
+// Lookup determines the SLCSP for a zip code the same way resolver.Resolver does
+// An error is only returned when the index contents are inconsistent
+func (idx *Index) Lookup(zip string) (model.Result, error) {
+	result := model.Result{Zip: zip}
+
+	// Binary search the sorted zip records, comparing them in place
+	key := []byte(zip)
+	count := idx.ZipCount()
+	i := sort.Search(count, func(i int) bool {
+		return bytes.Compare(trimField(idx.zipRecord(i)[:zipSize]), key) >= 0
+	})
+	if i == count || !bytes.Equal(trimField(idx.zipRecord(i)[:zipSize]), key) {
+		return result, nil
+	}
+
+	record := idx.zipRecord(i)
+	firstArea := byteOrder.Uint32(record[zipSize:])
+	areaCount := byteOrder.Uint32(record[zipSize+4:])
+	if areaCount > 1 {
+		result.Ambiguous = true
+		return result, nil
+	}
+	if areaCount == 0 {
+		return result, nil
+	}
+	if int(firstArea) >= len(idx.zipAreas)/zipAreaItemSize {
+		return result, fmt.Errorf("index refers to missing rate areas for zip code %s", zip)
+	}
+
+	rateArea, firstRate, rateCount, err := idx.rateArea(byteOrder.Uint32(idx.zipAreas[int(firstArea)*zipAreaItemSize:]))
+	if err != nil {
+		return result, err
+	}
+	if int(firstRate)+int(rateCount) > len(idx.rates)/rateRecordSize {
+		return result, fmt.Errorf("index refers to missing rates for rate area %s", rateArea)
+	}
+	result.RateArea = rateArea
+
+	// If no second lowest rate, leave the rate unset
+	if rateCount >= 2 {
+		rate := idx.rate(firstRate + 1)
+		result.Rate = &rate
+	}
+
+	return result, nil
+}
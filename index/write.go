@@ -0,0 +1,134 @@
+package index
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+
+	"slcsp/model"
+	"slcsp/resolver"
+)
+
+// putString copies value into a fixed-size field, failing if it doesn't fit
+func putString(field []byte, value string, name string) error {
+	if len(value) > len(field) {
+		return fmt.Errorf("%s %q is longer than the %d bytes an index can hold", name, value, len(field))
+	}
+	copy(field, value)
+	return nil
+}
+
+// Write writes an index of every zip code and rate area known to r
+func Write(w io.Writer, r *resolver.Resolver) error {
+	var areas, rates, zips, zipAreas bytes.Buffer
+
+	// Number the rate areas in the order they're written
+	areaNumbers := make(map[model.RateArea]uint32)
+	rateCount := uint32(0)
+	for _, summary := range r.RateAreaSummaries() {
+		areaRates := r.SilverRates(summary.RateArea)
+
+		record := make([]byte, areaRecordSize)
+		if err := putString(record[0:stateSize], summary.RateArea.State, "state"); err != nil {
+			return err
+		}
+		if err := putString(record[stateSize:stateSize+codeSize], summary.RateArea.Code, "rate area"); err != nil {
+			return err
+		}
+		byteOrder.PutUint32(record[stateSize+codeSize:], rateCount)
+		byteOrder.PutUint32(record[stateSize+codeSize+4:], uint32(len(areaRates)))
+		areas.Write(record)
+
+		for _, rate := range areaRates {
+			item := make([]byte, rateRecordSize)
+			byteOrder.PutUint64(item, math.Float64bits(rate))
+			rates.Write(item)
+		}
+
+		areaNumbers[summary.RateArea] = uint32(len(areaNumbers))
+		rateCount += uint32(len(areaRates))
+	}
+
+	// Zips are already sorted, which lookups rely on to binary search them
+	zipAreaCount := uint32(0)
+	for _, zip := range r.Zips() {
+		zipRateAreas := r.RateAreas(zip)
+
+		record := make([]byte, zipRecordSize)
+		if err := putString(record[0:zipSize], zip, "zip code"); err != nil {
+			return err
+		}
+		byteOrder.PutUint32(record[zipSize:], zipAreaCount)
+		byteOrder.PutUint32(record[zipSize+4:], uint32(len(zipRateAreas)))
+		zips.Write(record)
+
+		for _, rateArea := range zipRateAreas {
+			item := make([]byte, zipAreaItemSize)
+			byteOrder.PutUint32(item, areaNumbers[rateArea])
+			zipAreas.Write(item)
+		}
+		zipAreaCount += uint32(len(zipRateAreas))
+	}
+
+	return writeSections(w, []section{
+		{tagAreas, areas.Bytes()},
+		{tagRates, rates.Bytes()},
+		{tagZips, zips.Bytes()},
+		{tagZipAreas, zipAreas.Bytes()},
+	})
+}
+
+// section is a tagged payload of an index file
+type section struct {
+	tag     string
+	payload []byte
+}
+
+// writeSections writes the header, directory and payloads of an index file
+// Payloads start on 8 byte boundaries so the rates can be read in place
+func writeSections(w io.Writer, sections []section) error {
+	header := make([]byte, headerSize)
+	copy(header, Magic)
+	byteOrder.PutUint16(header[len(Magic):], MajorVersion)
+	byteOrder.PutUint16(header[len(Magic)+2:], MinorVersion)
+	byteOrder.PutUint32(header[len(Magic)+4:], uint32(len(sections)))
+
+	offset := uint64(align(headerSize + dirEntrySize*len(sections)))
+	directory := make([]byte, 0, dirEntrySize*len(sections))
+	for _, s := range sections {
+		entry := make([]byte, dirEntrySize)
+		copy(entry, s.tag)
+		byteOrder.PutUint64(entry[4:], offset)
+		byteOrder.PutUint64(entry[12:], uint64(len(s.payload)))
+		directory = append(directory, entry...)
+		offset = uint64(align(int(offset) + len(s.payload)))
+	}
+
+	written := 0
+	for _, part := range [][]byte{header, directory} {
+		n, err := w.Write(part)
+		if err != nil {
+			return err
+		}
+		written += n
+	}
+	for _, s := range sections {
+		if _, err := w.Write(make([]byte, align(written)-written)); err != nil {
+			return err
+		}
+		written = align(written)
+		n, err := w.Write(s.payload)
+		if err != nil {
+			return err
+		}
+		written += n
+	}
+
+	return nil
+}
+
+// align rounds n up to a multiple of 8
+func align(n int) int {
+	return (n + 7) &^ 7
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"slcsp/index"
+	"slcsp/resolver"
+	"slcsp/source"
+)
+
+// DefaultIndexFileName is the index file written and read when no other is named
+const DefaultIndexFileName string = "slcsp.idx"
+
+// runIndex implements the `index` command
+// `index build` writes an index file from the zips and plans files, `index info` describes one, and
+// `index rows` writes the row indexes that -exit-early reads the zips and plans files with
+func runIndex(args []string) error {
+	usage := fmt.Errorf("usage: slcsp index build [-o %s] | slcsp index info [%s] | slcsp index rows", DefaultIndexFileName, DefaultIndexFileName)
+	if len(args) == 0 {
+		return usage
+	}
+
+	switch args[0] {
+	case "build":
+		flags := flag.NewFlagSet("index build", flag.ExitOnError)
+		output := flags.String("o", DefaultIndexFileName, "index file to write")
+		zips := flags.String("zips", ZipsFileName, "zips file to read")
+		plans := flags.String("plans", PlansFileName, "plans file to read")
+		flags.Parse(args[1:])
+
+		r, err := resolver.Load(context.Background(), source.Files{Zips: *zips, Plans: *plans})
+		if err != nil {
+			return err
+		}
+
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		w := bufio.NewWriter(file)
+		if err := index.Write(w, r); err != nil {
+			file.Close()
+			return err
+		}
+		if err := w.Flush(); err != nil {
+			file.Close()
+			return err
+		}
+		return file.Close()
+
+	case "info":
+		name := DefaultIndexFileName
+		if len(args) > 1 {
+			name = args[1]
+		}
+		file, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		idx, err := index.Read(file)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		fmt.Printf("File:        %s\n", name)
+		fmt.Printf("Version:     %d.%d\n", idx.Major, idx.Minor)
+		fmt.Printf("Zip codes:   %d\n", idx.ZipCount())
+		fmt.Printf("Rate areas:  %d\n", idx.RateAreaCount())
+		return nil
+
+	case "rows":
+		flags := flag.NewFlagSet("index rows", flag.ExitOnError)
+		zips := flags.String("zips", ZipsFileName, "zips file to index by zip code")
+		plans := flags.String("plans", PlansFileName, "plans file to index by rate area")
+		var opts source.Options
+		flags.BoolVar(&opts.LazyQuotes, "lazy-quotes", false, "allow stray quotes, as the main command's -lazy-quotes")
+		flags.BoolVar(&opts.TrimLeadingSpace, "trim-leading-space", false, "ignore spaces at the start of fields, as the main command's -trim-leading-space")
+		flags.BoolVar(&opts.Sniff, "sniff", false, "work out each file's delimiter and whether it has a header, as the main command's -sniff")
+		flags.Parse(args[1:])
+
+		if err := writeRowIndex(*zips, source.IndexZipRows, opts); err != nil {
+			return err
+		}
+		return writeRowIndex(*plans, source.IndexPlanRows, opts)
+
+	default:
+		return usage
+	}
+}
+
+// writeRowIndex indexes the rows of the named file, read with opts, writing the index beside it
+func writeRowIndex(fileName string, build func(string, io.Reader, source.Options) (*source.RowIndex, error), opts source.Options) error {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	idx, err := build(fileName, bufio.NewReader(file), opts)
+	if err != nil {
+		return err
+	}
+	idx.Size = info.Size()
+	idx.ModTime = info.ModTime()
+	return source.WriteRowIndex(fileName+source.RowIndexSuffix, idx)
+}
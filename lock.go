@@ -0,0 +1,129 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DatasetLockFileName is the default name of a dataset manifest
+const DatasetLockFileName = "dataset.lock"
+
+// DatasetLock is a manifest of the exact input files results are computed from
+type DatasetLock struct {
+	PlanYear int          `json:"plan_year,omitempty"`
+	Files    []LockedFile `json:"files"`
+}
+
+// LockedFile is an input file recorded in a DatasetLock
+// Source is where the file was obtained from, if known
+type LockedFile struct {
+	Name   string `json:"name"`
+	Source string `json:"source,omitempty"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// hashFile records the size and SHA-256 hash of an input file
+func hashFile(open openFunc, fileName string) (LockedFile, error) {
+	file, err := open(fileName)
+	if err != nil {
+		return LockedFile{}, err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return LockedFile{}, fmt.Errorf("%s: %w", fileName, err)
+	}
+	return LockedFile{Name: fileName, Size: size, SHA256: hex.EncodeToString(hash.Sum(nil))}, nil
+}
+
+// readDatasetLock reads a manifest
+func readDatasetLock(fileName string) (*DatasetLock, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	lock := &DatasetLock{}
+	if err := json.Unmarshal(data, lock); err != nil {
+		return nil, fmt.Errorf("%s: %w", fileName, err)
+	}
+	return lock, nil
+}
+
+// Write writes the manifest as JSON to the named file
+func (l *DatasetLock) Write(fileName string) error {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fileName, append(data, '\n'), 0644)
+}
+
+// Verify checks that every file in the manifest is unchanged, hashing them with hash, and reports all that aren't
+func (l *DatasetLock) Verify(hash hashFunc) error {
+	problems := make([]string, 0)
+	for _, locked := range l.Files {
+		current, err := hash(locked.Name)
+		switch {
+		case err != nil:
+			problems = append(problems, err.Error())
+		case current.SHA256 != locked.SHA256:
+			problems = append(problems, fmt.Sprintf("%s has changed: sha256 %s, locked %s", locked.Name, current.SHA256, locked.SHA256))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("input files don't match the dataset lock: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// runLock implements the `lock` command, writing a manifest of the input files
+func runLock(args []string) error {
+	flags := flag.NewFlagSet("lock", flag.ExitOnError)
+	year := flags.Int("year", 0, "plan year of the files")
+	output := flags.String("o", DatasetLockFileName, "file to write the manifest to")
+	sources := make(pairsFlag)
+	flags.Var(sources, "source", "where a file came from, e.g. plans.csv=https://example.com/plans.zip; can be repeated")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: slcsp lock [flags] [files...] (default: %s %s)\n", ZipsFileName, PlansFileName)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	fileNames := flags.Args()
+	if len(fileNames) == 0 {
+		fileNames = []string{ZipsFileName, PlansFileName}
+	}
+
+	lock := &DatasetLock{PlanYear: *year, Files: make([]LockedFile, 0, len(fileNames))}
+	for _, fileName := range fileNames {
+		locked, err := hashFile(openOS, filepath.Clean(fileName))
+		if err != nil {
+			return err
+		}
+		lock.Files = append(lock.Files, locked)
+	}
+
+	for name, source := range sources {
+		found := false
+		for i := range lock.Files {
+			if lock.Files[i].Name == filepath.Clean(name) {
+				lock.Files[i].Source = source
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("-source names %s, which isn't one of the files locked", name)
+		}
+	}
+	return lock.Write(*output)
+}
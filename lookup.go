@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"slcsp/index"
+	"slcsp/model"
+)
+
+// runLookup implements the `lookup` command, answering SLCSP lookups for the zip codes given as
+// arguments straight from a memory-mapped index file
+func runLookup(args []string) error {
+	flags := flag.NewFlagSet("lookup", flag.ExitOnError)
+	indexFile := flags.String("index", DefaultIndexFileName, "index file written by `slcsp index build`")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		return fmt.Errorf("usage: slcsp lookup [-index %s] zipcode [zipcode ...]", DefaultIndexFileName)
+	}
+
+	idx, err := index.Open(*indexFile)
+	if err != nil {
+		return err
+	}
+	defer idx.Close()
+
+	results := make([]model.Result, 0, flags.NArg())
+	for _, zip := range flags.Args() {
+		result, err := idx.Lookup(zip)
+		if err != nil {
+			return fmt.Errorf("%s: %w", *indexFile, err)
+		}
+		results = append(results, result)
+	}
+
+	return writeResults(os.Stdout, results, OutputOptions{})
+}
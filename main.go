@@ -1,13 +1,22 @@
 package main
 
 import (
-	"encoding/csv"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"io"
+	"io/fs"
 	"log"
 	"os"
-	"sort"
-	"strconv"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	"slcsp/model"
+	"slcsp/resolver"
+	"slcsp/source"
 )
 
 // File names
@@ -15,206 +24,723 @@ const SlcspFileName string = "slcsp.csv"
 const ZipsFileName string = "zips.csv"
 const PlansFileName string = "plans.csv"
 
-// RateData holds the rating information for a zip code
-// RateArea is a string where `state` and `rate_area` are concatenated from ZipsFileName/PlansFileName
-// Rates is a slice of applicable rates found for the RateArea from PlansFileName
-// Ambiguous marks whether a zip has multiple RateArea
-type RateData struct {
-	RateArea  string
-	Rates     []float64
-	Ambiguous bool
+// batchIndexFileName is the summary written to -output-dir
+const batchIndexFileName = "index.csv"
+
+// commands maps each command name to the function that runs it with the remaining arguments
+// Running without a command name calculates the SLCSP for each zip code in SlcspFileName
+var commands = map[string]func(args []string) error{
+	"describe": runDescribe,
+	"compare":  runCompare,
+	"trend":    runTrend,
+	"areas":    runAreas,
+	"gaps":     runGaps,
+	"check":    runCheck,
+	"export":   runExport,
+	"map":      runMap,
+	"index":    runIndex,
+	"lookup":   runLookup,
+	"cheapest": runCheapest,
+	"rank":     runRank,
+	"lock":     runLock,
+	"audit":    runAudit,
+	"bench":    runBench,
+	"canary":   runCanary,
+	"verify":   runVerify,
+	"history":  runHistory,
 }
 
-// concatRateArea creates the RateArea string for use in RateData
-// It expects the `state` and the `rate_area` from ZipsFileName/PlansFileName
-func concatRateArea(state string, code string) string {
-	rateArea := fmt.Sprintf("%s%s", state, code)
-	return rateArea
-}
-
-// parseSlcsp reads the data in SlcspFileName and returns all of the zip codes from it
-func parseSlcsp() ([]string, error) {
-	zips := make([]string, 0)
-	slcspFile, err := os.Open(SlcspFileName)
-	if err != nil {
-		return zips, err
+func main() {
+	// Run the named command if there is one
+	if len(os.Args) > 1 {
+		if command, exists := commands[os.Args[1]]; exists {
+			if err := command(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
 	}
-	defer slcspFile.Close()
-
-	slcspReader := csv.NewReader(slcspFile)
-	slcspReader.FieldsPerRecord = 2
 
-	// Skip first line (header)
-	_, err = slcspReader.Read()
-	if err != nil {
-		return zips, err
+	var slcspOpts, zipsOpts, plansOpts source.Options
+	flag.BoolVar(&slcspOpts.NoHeader, "slcsp-no-header", false, "treat the first line of "+SlcspFileName+" as data rather than a header")
+	flag.BoolVar(&zipsOpts.NoHeader, "zips-no-header", false, "treat the first line of "+ZipsFileName+" as data rather than a header")
+	flag.BoolVar(&plansOpts.NoHeader, "plans-no-header", false, "treat the first line of "+PlansFileName+" as data rather than a header")
+	flag.Var(&columnsFlag{&slcspOpts.Columns, source.QueryLayout}, "slcsp-cols", "rename columns of "+SlcspFileName+", e.g. zipcode=zip")
+	flag.Var(&columnsFlag{&zipsOpts.Columns, source.ZipsLayout}, "zips-cols", "rename columns of "+ZipsFileName+", e.g. rate_area=area,name=county")
+	flag.Var(&columnsFlag{&plansOpts.Columns, append(source.PlansLayout, source.PlansOptional...)}, "plans-cols", "rename columns of "+PlansFileName+", e.g. rate=premium,metal_level=tier")
+	lazyQuotes := flag.Bool("lazy-quotes", false, "allow stray quotes inside unquoted fields and non-doubled quotes inside quoted fields")
+	trimLeadingSpace := flag.Bool("trim-leading-space", false, "ignore spaces at the start of fields")
+	fastCSV := flag.Bool("fast-csv", false, "read the input files with a faster CSV parser than the standard one, for very large files")
+	sniff := flag.Bool("sniff", false, "work out each input file's encoding (UTF-8, UTF-16 or Windows-1252), delimiter (comma, tab, semicolon or pipe) and whether it has a header, in place of the -no-header flags")
+	verbose := flag.Bool("verbose", false, "log more about how the input files were read, such as what -sniff found and -exit-early reading a file without a row index in full")
+	keepGoing := flag.Bool("keep-going", false, "skip records and files that can't be read, output what can be resolved and report the problems")
+	errorSummaryFile := flag.String("error-summary", "", "with -keep-going, write the JSON error summary to this file instead of stderr")
+	var outputOpts OutputOptions
+	flag.BoolVar(&outputOpts.CountyCode, "county-code", false, "add a county_code column with the FIPS code of each zip code's county, joined by | when there are several")
+	flag.BoolVar(&outputOpts.CountyName, "county-name", false, "add a county_name column with the name of each zip code's county, joined by | when there are several")
+	flag.BoolVar(&outputOpts.CountyRows, "county-rows", false, "output a row per county for zip codes in several counties, rather than joining their codes and names")
+	flag.BoolVar(&outputOpts.NoHeader, "quiet", false, "write nothing to stdout but the result records, leaving out the CSV header")
+	flag.StringVar(&outputOpts.Blank, "blank", "", "write this as the rate of zip codes with no benchmark, e.g. N/A or 0.00, rather than leaving it empty (CSV and table output)")
+	showSummary := flag.Bool("summary", false, "after the results, write a summary of them and how long each stage took to stderr (or -log-file)")
+	summaryJSON := flag.String("summary-json", "", "write a JSON summary of the results, blank zip codes by reason, rate areas and the time of each stage to this file, or - for stdout after the results")
+	reportFile := flag.String("report", "", "write a JSON report of the run's resource use to this file, or - for stdout after the results: peak memory, garbage collection, rows parsed and skipped in each file, and the time of each stage")
+	table := flag.Bool("table", false, "when stdout is a terminal, show the results as an aligned, colored table with counts rather than CSV (set NO_COLOR to turn off colors)")
+	allWarnings := flag.Bool("all-warnings", false, "log every warning, rather than the first of each kind with how many there were")
+	logFile := flag.String("log-file", "", "write diagnostics to this file instead of stderr")
+	filterText := flag.String("filter", "", "only output zip codes matching an expression such as 'rate > 300 && state == \"KS\"', using the fields zipcode, rate, state, rate_area, ambiguous, county_code and county_name")
+	noPrefilter := flag.Bool("no-prefilter", false, "keep every row of "+ZipsFileName+" rather than only the queried zip codes")
+	suffix := flag.String("suffix", ".slcsp", "with query files given as arguments, add this to each one's name for its results file, e.g. client.csv gives client.slcsp.csv")
+	zipList := flag.Bool("zip-list", false, "read query files as plain lists of zip codes, one per line, rather than CSV")
+	queryRateAreas := flag.Bool("query-rate-areas", false, "query files list rate areas, with state and rate_area columns, rather than zip codes; each one's benchmark is output without reading "+ZipsFileName)
+	stdio := flag.Bool("stdio", false, "keep running, answering newline-delimited JSON requests on stdin with responses on stdout: {\"method\":\"lookup\",\"zip\":\"64148\"}, {\"method\":\"bulk\",\"zips\":[...]} or {\"method\":\"reload\"}, each with an optional id")
+	inputDir := flag.String("input-dir", "", "answer every CSV query file in this directory tree, writing the results to the same place in -output-dir")
+	outputDir := flag.String("output-dir", "", "directory to write the results of -input-dir to, along with an index.csv summarizing them")
+	demo := flag.Bool("demo", false, "use the built in sample "+SlcspFileName+", "+ZipsFileName+" and "+PlansFileName+" instead of reading any files")
+	var quarters layersFlag
+	flag.Var(&quarters, "quarter", "layer a later rate filing shaped like "+PlansFileName+" over it, e.g. Q2=plans_q2.csv, replacing the rates of the plans it has and adding a rate_source column; can be repeated, latest last")
+	metals := flag.String("metal", "Silver", "comma separated metal levels the benchmark is chosen from")
+	exclude := flag.String("exclude", "", "leave plans whose ID or metal level matches this regular expression out of the benchmark, e.g. 'Expanded|-0[2-6]$'")
+	csrMode := flag.String("csr", "", "handle cost-sharing reduction variants of plans (IDs ending -01 to -06): collapse to one row per base plan, or a variant such as 01 to keep only that one")
+	duplicates := flag.String("duplicates", "keep", "what to do with zip codes a query file repeats, which are warned about: keep a row for each, or collapse to the first")
+	var bounds rateBounds
+	flag.Float64Var(&bounds.Min, "min-rate", 0, "warn about plans with a rate below this, such as from a shifted decimal point")
+	flag.Float64Var(&bounds.Max, "max-rate", 0, "warn about plans with a rate above this")
+	excludeOutOfBounds := flag.Bool("exclude-out-of-bounds", false, "leave plans outside -min-rate and -max-rate out of the benchmark rather than only warning")
+	age := flag.Int("age", 0, "reference age to read a "+PlansFileName+" with a row per plan and age at, such as a CMS Rate PUF, e.g. 21 or 40; rows of other ages are skipped")
+	badRates := flag.String("bad-rates", string(source.BadRatesError), "what to do with plans whose rate is empty, zero or negative: error, skip with a warning, or include as given (empty as zero)")
+	normalizeRateAreas := flag.Bool("normalize-rate-areas", false, "match rate areas however they're written, trimming spaces, upper-casing states and stripping leading zeros from codes, so \"07\" in one file matches \"7\" in another")
+	exitEarly := flag.Bool("exit-early", false, "read only the rows of "+ZipsFileName+" and "+PlansFileName+" the queried zip codes need, using the row indexes written by slcsp index rows, for near-instant lookups of a few zip codes")
+	maxMemory := flag.String("max-memory", "", "memory budget such as 512MB; when the zips and plans files would take more, only the rows the queried zip codes need are kept")
+	workers := flag.Int("workers", runtime.GOMAXPROCS(0), "number of input files read and lookups made at once")
+	minPlans := flag.Int("min-plans", 0, "leave rate areas with fewer than this many Silver plans without a benchmark; 0 for what their rule needs, 2 for second-lowest")
+	var thin thinMarkets
+	flag.IntVar(&thin.Below, "suppress-below", 0, "for results to be shared, blank the benchmarks of rate areas with fewer than this many plans to choose them from, as data release rules need for thin markets")
+	flag.Float64Var(&thin.Round, "suppress-round", 0, "with -suppress-below, round those benchmarks to a multiple of this, e.g. 25, rather than blanking them")
+	planRowsFlag := flag.Bool("plan-rows", false, "output a row for each of a zip code's two cheapest Silver plans, with its rank, plan_id and premium; nested as cheapest_plans in json and ndjson -output")
+	showBlankReason := flag.Bool("blank-reason", false, "add a blank_reason column saying why a zip code has no rate: ambiguous, not_found, no_plans, or too_few_plans for -min-plans or its rule")
+	ambiguousAreas := flag.Bool("ambiguous-areas", false, "add a rate_areas column listing the rate areas each ambiguous zip code is in, e.g. MO3|MO4")
+	showAllRates := flag.Bool("all-rates", false, "in json and ndjson -output, add all_rates with the rates each benchmark was chosen from, least to greatest")
+	geographyName := flag.String("geography", "zip", "what locations are keyed by in the query files and "+ZipsFileName+": zip, county (FIPS codes, with no county columns), postal-prefix or region")
+	keyColumn := flag.String("key-column", "", "name of the column holding each location, if not the -geography's usual one (zipcode, county_code, postal_prefix or region)")
+	stateRuleNames := make(pairsFlag)
+	flag.Var(stateRuleNames, "state-rule", "choose the benchmarks of a state's rate areas with another rule, e.g. VT=lowest, for marketplaces with their own; can be repeated")
+	var limits source.Limits
+	flag.IntVar(&limits.MaxRecordBytes, "max-record-bytes", 0, "stop with an error at a line or record of an input file longer than this many bytes (0 for no limit)")
+	flag.IntVar(&limits.MaxFields, "max-fields", 0, "stop with an error at a record of an input file with more fields than this (0 for no limit)")
+	flag.IntVar(&limits.MaxRows, "max-rows", 0, "stop with an error at an input file with more rows than this, counting the header (0 for no limit)")
+	metadataMode := flag.String("metadata", "", "describe each results file with the tool version, input file hashes, time and parameters: as comment lines in a header or trailer, or a sidecar .meta.json file")
+	explain := flag.Bool("explain", false, "add benchmark_plan_id and tied_plans columns with the plan chosen as each benchmark and how many share its rate, and its -plan-attributes")
+	attributesFile := flag.String("plan-attributes", "", "with -explain, CSV file of plan details such as names and network types, keyed by a plan_id column, to add to the output")
+	issuersFile := flag.String("issuers", "", "CSV crosswalk of issuer_id to issuer_name, adding the benchmark plans' issuer names to the output (implies -explain)")
+	asOf := flag.String("as-of", "", "only use plan rates in force on this date, e.g. 2025-03-01, going by the effective_date and expiration_date columns of "+PlansFileName)
+	storeDir := flag.String("store", "", "also add the results to this results store, such as "+DefaultHistoryDir+", as a run dated now, for slcsp history")
+	signMode := flag.String("sign", "", "sign the results so changes to them can be detected with slcsp verify: with an HMAC comment line after them as a trailer, or in a detached .sig file beside each results file")
+	signKeyFile := flag.String("sign-key", "", "with -sign, file holding the secret to sign the results with")
+	requireList := flag.String("require", "", "comma separated optional inputs that must exist, rather than being left out with a warning when missing: "+strings.Join(optionalInputs, ", "))
+	lockFile := flag.String("lock", DatasetLockFileName, "check the input files against this manifest from slcsp lock, and copy it to -output-dir; by default only if it exists")
+	var sinks sinksFlag
+	flag.Var(&sinks, "output", "write the results to format:destination instead of stdout, where format is csv, json, ndjson or summary and destination is - for stdout, a file name or an http(s) URL to post to; can be repeated")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [query files or patterns..., or - for stdin]\n", os.Args[0])
+		flag.PrintDefaults()
 	}
+	flag.Parse()
 
-	// Read file data
-	for {
-		record, err := slcspReader.Read()
+	if *logFile != "" {
+		file, err := os.OpenFile(*logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer file.Close()
+		log.SetOutput(file)
+	}
 
-		// Stop at end of file
-		if err == io.EOF {
+	var batches []queryBatch
+	var err error
+	switch {
+	case (*inputDir != "" || *outputDir != "") && flag.NArg() > 0:
+		err = fmt.Errorf("query files can't be given as arguments with -input-dir")
+	case *inputDir != "" || *outputDir != "":
+		batches, err = dirBatches(*inputDir, *outputDir)
+	default:
+		batches, err = queryBatches(flag.Args(), *suffix)
+	}
+	if err == nil && len(sinks) > 0 && len(batches) > 1 {
+		err = fmt.Errorf("-output can only be used with a single query file")
+	}
+	if err == nil && *demo && (flag.NArg() > 0 || *inputDir != "") {
+		err = fmt.Errorf("-demo reads the built in %s, so query files can't be given", SlcspFileName)
+	}
+	var asOfDate time.Time
+	if err == nil && *asOf != "" {
+		asOfDate, err = time.Parse(source.DateLayout, *asOf)
+	}
+	if err == nil {
+		err = checkCSRMode(*csrMode)
+	}
+	if err == nil {
+		err = checkDuplicatesMode(*duplicates)
+	}
+	if err == nil {
+		err = bounds.check()
+	}
+	if err == nil {
+		err = source.BadRatePolicy(*badRates).Check()
+	}
+	if err == nil && *showAllRates && !sinks.hasFormat("json", "ndjson") {
+		err = fmt.Errorf("-all-rates is only written in json and ndjson -output")
+	}
+	var geography source.Geography
+	if err == nil {
+		geography, err = source.LookupGeography(*geographyName, *keyColumn)
+	}
+	if err == nil && *queryRateAreas && (*zipList || *geographyName != "zip" || *exitEarly || *ambiguousAreas || outputOpts.CountyCode || outputOpts.CountyName || outputOpts.CountyRows) {
+		err = fmt.Errorf("-query-rate-areas can't be used with -zip-list, -geography, -exit-early, -ambiguous-areas or the county flags, which are about zip codes")
+	}
+	if err == nil && geography.NoCounties && (outputOpts.CountyCode || outputOpts.CountyName || outputOpts.CountyRows) {
+		err = fmt.Errorf("-geography %s has no counties for -county-code, -county-name or -county-rows", geography.Name)
+	}
+	stateRules := make(map[string]resolver.BenchmarkRule)
+	for state, name := range stateRuleNames {
+		rule, exists := resolver.Rule(name)
+		if !exists {
+			err = fmt.Errorf("unknown -state-rule %s=%s, expected one of: %s", state, name, strings.Join(resolver.RuleNames(), ", "))
 			break
 		}
+		stateRules[state] = rule
+	}
+	if err == nil && *metadataMode != "" && !contains(metadataModes, *metadataMode) {
+		err = fmt.Errorf("unknown -metadata %q, expected one of: %s", *metadataMode, strings.Join(metadataModes, ", "))
+	}
+	if err == nil && *metadataMode == "sidecar" && (len(sinks) > 0 || toStdout(batches)) {
+		err = fmt.Errorf("-metadata sidecar needs a results file for every query file, so can't be used with stdin or a query file that isn't a regular file, whose results go to stdout")
+	}
+	if err == nil && *storeDir != "" && *queryRateAreas {
+		err = fmt.Errorf("-store keeps zip codes' benchmarks, so can't be used with -query-rate-areas")
+	}
+	if err == nil && *stdio && (flag.NArg() > 0 || *inputDir != "" || len(sinks) > 0 || *exitEarly || *queryRateAreas || *keepGoing) {
+		err = fmt.Errorf("-stdio answers requests rather than query files, so can't be used with query files, -input-dir, -output, -exit-early, -query-rate-areas or -keep-going")
+	}
+	if err == nil && *stdio && (len(quarters) > 0 || *asOf != "" || *csrMode != "" || bounds != (rateBounds{})) {
+		err = fmt.Errorf("-stdio answers from the files as the resolver reads them, so can't be used with -quarter, -as-of, -csr, -min-rate or -max-rate")
+	}
+	if err == nil && *signMode != "" && !contains(signModes, *signMode) {
+		err = fmt.Errorf("unknown -sign %q, expected one of: %s", *signMode, strings.Join(signModes, ", "))
+	}
+	if err == nil && (*signMode != "") != (*signKeyFile != "") {
+		err = fmt.Errorf("-sign and -sign-key are used together")
+	}
+	if err == nil && *signMode != "" && (len(sinks) > 0 || *table) {
+		err = fmt.Errorf("-sign signs CSV results, so can't be used with -output or -table")
+	}
+	if err == nil && *signMode == "detached" && toStdout(batches) {
+		err = fmt.Errorf("-sign detached needs a results file for every query file, so can't be used with stdin or a query file that isn't a regular file, whose results go to stdout; use -sign trailer")
+	}
+	if err == nil && outputOpts.NoHeader && (*summaryJSON == "-" || *reportFile == "-") {
+		err = fmt.Errorf("-quiet leaves nothing on stdout but result records, so -summary-json and -report need a file rather than -")
+	}
+	if err == nil && outputOpts.NoHeader && toStdout(batches) && (*metadataMode == "header" || *metadataMode == "trailer" || *signMode == "trailer") {
+		err = fmt.Errorf("-quiet leaves nothing on stdout but result records, so can't be used with -metadata header, -metadata trailer or -sign trailer when results go to stdout")
+	}
+	var signKey []byte
+	if err == nil && *signKeyFile != "" {
+		signKey, err = readSignKey(*signKeyFile)
+	}
+	var required map[string]bool
+	if err == nil {
+		required, err = parseRequired(*requireList)
+	}
+	if err == nil && *exitEarly && *noPrefilter {
+		err = fmt.Errorf("-exit-early only reads the queried zip codes, so can't be used with -no-prefilter")
+	}
+	if err == nil && *age < 0 {
+		err = fmt.Errorf("-age can't be negative")
+	}
+	if err == nil && *minPlans < 0 {
+		err = fmt.Errorf("-min-plans can't be negative")
+	}
+	if err == nil {
+		err = thin.check()
+	}
+	if err == nil && thin.Below > 0 && (*planRowsFlag || *showAllRates || *explain || *issuersFile != "" || *stdio) {
+		err = fmt.Errorf("-suppress-below hides thin markets' rates from results files, so can't be used with -stdio, or -plan-rows, -all-rates, -explain or -issuers, which show them")
+	}
+	if err == nil && *workers < 1 {
+		err = fmt.Errorf("-workers must be at least 1")
+	}
+	var memoryBudget int64
+	if err == nil && *maxMemory != "" {
+		memoryBudget, err = parseByteSize(*maxMemory)
+	}
+	if err == nil && *attributesFile != "" && !*explain && *issuersFile == "" {
+		err = fmt.Errorf("-plan-attributes is only used with -explain or -issuers")
+	}
+	var excludePattern *regexp.Regexp
+	if err == nil && *exclude != "" {
+		excludePattern, err = regexp.Compile(*exclude)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
 
-		if err != nil {
-			return zips, err
+	var filter *Filter
+	if *filterText != "" {
+		if filter, err = parseFilter(*filterText); err != nil {
+			log.Fatal(err)
 		}
+	}
 
-		// Record fields:
-		// 0 - zipcode
-		// 1 - rate
-		// Only store the zipcode field since rate will be empty here
-		zips = append(zips, record[0])
+	summary := &ErrorSummary{Complete: true, Errors: make([]SummaryError, 0)}
+	warnings := &warningLog{all: *allWarnings}
+	var readStats *source.ReadStats
+	if *reportFile != "" {
+		readStats = &source.ReadStats{}
+	}
+	for _, opts := range []*source.Options{&slcspOpts, &zipsOpts, &plansOpts} {
+		opts.LazyQuotes = *lazyQuotes
+		opts.TrimLeadingSpace = *trimLeadingSpace
+		opts.FastCSV = *fastCSV
+		opts.BadRates = source.BadRatePolicy(*badRates)
+		opts.Geography = geography
+		opts.Limits = limits
+		opts.Stats = readStats
+		opts.NormalizeRateAreas = *normalizeRateAreas
+		opts.OnWarning = warnings.warnError
+		opts.Sniff = *sniff
+		if *verbose {
+			opts.OnSniff = logSniffed
+		}
+		if *keepGoing {
+			opts.OnError = func(err error) error {
+				summary.Add(err)
+				return nil
+			}
+		}
 	}
 
-	return zips, err
-}
+	plansOpts.Age = *age
 
-// parseZips reads the data from ZipsFileName and adds RateArea info to the zip
-func parseZips(zips map[string]*RateData) (map[string]*RateData, error) {
-	zipsFile, err := os.Open(ZipsFileName)
-	if err != nil {
-		return zips, err
+	// checkParse stops the program on an error reading a file
+	// With -keep-going the error is added to the summary instead, and whatever was read before it is used
+	checkParse := func(err error) {
+		warnings.flush()
+		if err == nil {
+			return
+		}
+		if !*keepGoing {
+			log.Fatalf("Error parsing data: %s", formatParseError(err))
+		}
+		summary.Add(err)
 	}
-	defer zipsFile.Close()
 
-	zipsReader := csv.NewReader(zipsFile)
-	zipsReader.FieldsPerRecord = 5
-
-	// Skip first line (header)
-	_, err = zipsReader.Read()
-	if err != nil {
-		return zips, err
+	open := openOS
+	if bakedDataset != nil {
+		open = openBaked(open)
+	}
+	if *demo {
+		open = openDemo
 	}
 
-	// Read file data
-	for {
-		record, err := zipsReader.Read()
+	// Inputs that can only be read once, such as FIFOs and process substitutions, are hashed as they're read
+	// rather than read again for the dataset lock or metadata
+	hash := func(name string) (LockedFile, error) { return hashFile(open, name) }
+	var streamed *readHashes
+	inputs := append([]string{ZipsFileName, PlansFileName}, quarters.files()...)
+	for _, batch := range batches {
+		inputs = append(inputs, batch.Input)
+	}
+	for _, name := range inputs {
+		if isStream(name) && streamed == nil {
+			streamed = &readHashes{}
+			open = streamed.wrap(open)
+			hash = streamed.hash
+		}
+	}
 
-		// Stop at end of file
-		if err == io.EOF {
-			break
+	// Make sure the inputs are the ones locked, before spending time on them unless they're only hashed once read
+	var lock *DatasetLock
+	if !*demo {
+		lockSet := false
+		flag.Visit(func(f *flag.Flag) { lockSet = lockSet || f.Name == "lock" })
+		if lock, err = readDatasetLock(*lockFile); err != nil && (lockSet || required["lock"] || !errors.Is(err, fs.ErrNotExist)) {
+			log.Fatalf("Error reading dataset lock: %v", err)
+		}
+		if lock != nil && streamed == nil {
+			if err := lock.Verify(hash); err != nil {
+				log.Fatal(err)
+			}
 		}
+	}
 
+	metalLevels := strings.Split(*metals, ",")
+	for i := range metalLevels {
+		metalLevels[i] = strings.TrimSpace(metalLevels[i])
+	}
+	resolverOpts := []resolver.Option{resolver.WithBenchmarkPool(benchmarkPool(metalLevels, excludePattern)), resolver.WithStateRules(stateRules), resolver.WithMinPlans(*minPlans)}
+
+	// Answer requests on stdin until it's closed, from every row of the files, which reload rereads
+	if *stdio {
+		files := source.Files{Zips: ZipsFileName, Plans: PlansFileName, ZipsOptions: zipsOpts, PlansOptions: plansOpts}
+		if *demo {
+			files.FS = demoFiles
+		} else if bakedDataset != nil {
+			files.FS = bakedDataset
+		}
+		r, err := resolver.Open(context.Background(), append(resolverOpts, resolver.WithSources(files))...)
+		warnings.flush()
 		if err != nil {
-			return zips, err
+			log.Fatalf("Error parsing data: %s", formatParseError(err))
+		}
+		if err := serveStdio(context.Background(), r, os.Stdin, os.Stdout, warnings.flush); err != nil {
+			log.Fatal(err)
 		}
+		return
+	}
 
-		// Record fields:
-		// 0 - zipcode
-		// 1 - state
-		// 2 - county_code
-		// 3 - name
-		// 4 - rate_area
-		zip := record[0]
-		// Store the rate area if the record's zipcode matches one in zips
-		// If the rate area is already set and differs from the current record's, mark the data as ambiguous
-		if _, exists := zips[zip]; exists {
-			rateArea := concatRateArea(record[1], record[4])
-			if zips[zip].RateArea == "" {
-				zips[zip].RateArea = rateArea
-			} else if zips[zip].RateArea != rateArea {
-				zips[zip].Ambiguous = true
-			}
+	// Read each query file to get zip codes, or rate areas, to be checked
+	runSummary := newRunSummary()
+	runSummary.sampleMemory = *reportFile != ""
+	readQueryFile := source.ReadQueries
+	switch {
+	case *zipList:
+		readQueryFile = readZipList
+	case *queryRateAreas:
+		readQueryFile = source.ReadRateAreaQueries
+	}
+	queried := make([]string, 0)
+	queriedAreas := make(map[model.RateArea]bool)
+	queryErrs := make([]error, len(batches))
+	forEach(*workers, len(batches), func(i int) {
+		batches[i].Results, queryErrs[i] = readQueries(open, batches[i].Input, slcspOpts, readQueryFile)
+	})
+	for i := range batches {
+		checkParse(queryErrs[i])
+		name := batches[i].Input
+		if name == stdinName {
+			name = "stdin"
+		}
+		if !*queryRateAreas && reportDuplicates(name, batches[i].Results, warnings) > 0 && *duplicates == "collapse" {
+			batches[i].Results = collapseDuplicates(batches[i].Results)
+		}
+		for _, result := range batches[i].Results {
+			queried = append(queried, result.Zip)
+			queriedAreas[result.RateArea] = true
 		}
 	}
 
-	return zips, err
-}
+	wildcards := !*queryRateAreas && hasWildcards(batches)
+	warnings.flush()
+	runSummary.mark("read queries")
 
-// parsePlans reads the data from PlansFileName and adds Rates to the zip/RateArea struct
-func parsePlans(zips map[string]*RateData) (map[string]*RateData, error) {
-	plansFile, err := os.Open(PlansFileName)
-	if err != nil {
-		return zips, err
+	// Over the memory budget, only keep the rows of the input files that the queried zip codes need
+	streaming := false
+	if memoryBudget > 0 {
+		if estimate := estimateMemory(ZipsFileName, PlansFileName); estimate > memoryBudget {
+			streaming = true
+			log.Printf("%s and %s would take about %dMB, over -max-memory, so only the queried zip codes and their rate areas are kept", ZipsFileName, PlansFileName, estimate>>20)
+		}
 	}
-	defer plansFile.Close()
 
-	plansReader := csv.NewReader(plansFile)
-	plansReader.FieldsPerRecord = 5
+	// The row indexes are of the files on disk, so can't stand in for others
+	if *exitEarly && (*demo || bakedDataset != nil || streamed != nil) {
+		log.Printf("Warning: -exit-early only works with regular %s and %s files, so they're read in full", ZipsFileName, PlansFileName)
+		*exitEarly = false
+	}
+	if *exitEarly && *normalizeRateAreas {
+		log.Printf("Warning: the row indexes of -exit-early are keyed by rate areas as they're written, so with -normalize-rate-areas %s and %s are read in full", ZipsFileName, PlansFileName)
+		*exitEarly = false
+	}
 
-	// Skip first line (header)
-	_, err = plansReader.Read()
-	if err != nil {
-		return zips, err
+	if *exitEarly && wildcards {
+		log.Printf("Warning: wildcard queries match zip codes from all of %s, so -exit-early can't be used and it's read in full", ZipsFileName)
+		*exitEarly = false
 	}
 
-	// Read file data
-	for {
-		record, err := plansReader.Read()
+	// Only the queried zip codes' mappings are needed, so the rest of ZipsFileName can be skipped
+	// Wildcard queries can match any of them, so it's read in full
+	if (!*noPrefilter || streaming) && !wildcards {
+		zipsOpts.Zips = source.NewZipFilter(queried)
+	}
 
-		// Stop at end of file
-		if err == io.EOF {
-			break
+	// Read ZipsFileName to get zip to rate area mappings, and PlansFileName to get rates for each rate area
+	// They're read at once, unless the plans are limited to the rate areas of the zip codes
+	// With -exit-early, only the rows of the zip codes and then of their rate areas are read
+	var zips []model.ZipMapping
+	var plans []model.Plan
+	var zipsErr, plansErr error
+	if *queryRateAreas {
+		// Rate areas are looked up directly, so ZipsFileName isn't needed
+		if !*noPrefilter {
+			plansOpts.RateAreas = queriedAreas
+		}
+		plans, plansErr = readPlans(open, plansOpts)
+	} else if *exitEarly {
+		zips, zipsErr = readZipsEarly(open, zipsOpts, queried, *verbose)
+		plansOpts.RateAreas = zipRateAreas(zips)
+		plans, plansErr = readPlansEarly(open, plansOpts, *verbose)
+	} else if streaming {
+		zips, zipsErr = readZips(open, zipsOpts)
+		plansOpts.RateAreas = zipRateAreas(zips)
+		plans, plansErr = readPlans(open, plansOpts)
+	} else {
+		forEach(*workers, 2, func(i int) {
+			if i == 0 {
+				zips, zipsErr = readZips(open, zipsOpts)
+			} else {
+				plans, plansErr = readPlans(open, plansOpts)
+			}
+		})
+	}
+	var ageErr *source.AgeError
+	if errors.As(plansErr, &ageErr) {
+		log.Fatalf("%v; choose one with -age", ageErr)
+	}
+	checkParse(errors.Join(zipsErr, plansErr))
+
+	// Expand wildcard queries into the zip codes they match, now those are known
+	if wildcards {
+		for i := range batches {
+			name := batches[i].Input
+			if name == stdinName {
+				name = "stdin"
+			}
+			var unmatched []string
+			if batches[i].Results, unmatched, err = expandWildcards(batches[i].Results, zips); err != nil {
+				log.Fatalf("Error in %s: %v", name, err)
+			}
+			for _, pattern := range unmatched {
+				warnings.warn(name+": unmatched wildcards", fmt.Sprintf("%s: %s matches no zip codes in %s", name, pattern, ZipsFileName))
+			}
 		}
+	}
 
-		if err != nil {
-			return zips, err
+	// Rate areas written differently in the files silently go without plans, so say which ones
+	if !*normalizeRateAreas {
+		wanted, from := zipRateAreas(zips), ZipsFileName
+		if *queryRateAreas {
+			wanted, from = queriedAreas, "the query files"
+		}
+		for _, described := range misspelledRateAreas(wanted, from, plans, PlansFileName) {
+			log.Printf("Warning: %s; use -normalize-rate-areas to match them", described)
 		}
+	}
 
-		// Record fields:
-		// 0 - plan_id
-		// 1 - state
-		// 2 - metal_level
-		// 3 - rate
-		// 4 - rate_area
-		rateArea := concatRateArea(record[1], record[4])
-		rate, err := strconv.ParseFloat(record[3], 64)
-		if err != nil {
-			return zips, err
+	// Layer the quarterly filings over PlansFileName, noting where each plan's rate came from
+	if len(quarters) > 0 {
+		for i := range plans {
+			plans[i].Source = PlansFileName
+		}
+		layers := make([][]model.Plan, len(quarters)+1)
+		layers[0] = plans
+		quarterErrs := make([]error, len(quarters))
+		forEach(*workers, len(quarters), func(q int) {
+			layers[q+1], quarterErrs[q] = source.ReadPlansFile(quarters[q].File, plansOpts)
+			for i := range layers[q+1] {
+				layers[q+1][i].Source = quarters[q].Label
+			}
+		})
+		for _, err := range quarterErrs {
+			checkParse(err)
+		}
+		plans = layerPlans(layers)
+	}
+	warnings.flush()
+	runSummary.mark("read inputs")
+
+	// Keep the rates in force on the -as-of date
+	if !asOfDate.IsZero() {
+		inForce := plans[:0]
+		dated := false
+		for _, plan := range plans {
+			dated = dated || plan.Dated()
+			if plan.InForce(asOfDate) {
+				inForce = append(inForce, plan)
+			}
+		}
+		if !dated {
+			log.Printf("Warning: %s has no effective or expiration dates, so -as-of has no effect", PlansFileName)
 		}
+		plans = inForce
+	}
+
+	// Stop CSR variants of a plan counting as separate plans
+	if plans, err = csrVariants(plans, *csrMode); err != nil {
+		log.Fatal(err)
+	}
 
-		// Loop through each stored rate area
-		// Store the rate if the record's rate area matches and it's a Silver plan
-		// Skip the zip's rate area if it's been marked as ambiguous
-		for _, rateData := range zips {
-			if rateArea == rateData.RateArea && !rateData.Ambiguous && record[2] == "Silver" {
-				rateData.Rates = append(rateData.Rates, rate)
+	// Catch implausible rates before they skew a rate area's benchmark
+	plans = applyRateBounds(plans, bounds, *excludeOutOfBounds, warnings)
+	warnings.flush()
+
+	r := resolver.New(zips, plans, resolverOpts...)
+	runSummary.mark("index")
+	if len(quarters) > 0 {
+		outputOpts.Columns = append(outputOpts.Columns, rateSourceColumn(r))
+	}
+	outputOpts.KeyColumn = geography.KeyColumn()
+	outputOpts.RateAreaKeys = *queryRateAreas
+	if *showAllRates {
+		outputOpts.AllRates = allRates(r)
+	}
+	if *planRowsFlag {
+		outputOpts.CheapestPlans = cheapestPlans(r)
+	}
+	if *showBlankReason {
+		outputOpts.Columns = append(outputOpts.Columns, blankReasonColumn(r, thin))
+	}
+	if *ambiguousAreas {
+		outputOpts.Columns = append(outputOpts.Columns, ambiguousAreasColumn(r))
+	}
+	if *explain || *issuersFile != "" {
+		var issuers map[string]string
+		if *issuersFile != "" {
+			issuers, err = source.ReadIssuersFile(*issuersFile, plansOpts)
+			if skipMissing(required, "issuers", err, "the "+source.ColIssuerName+" column is left out", warnings) {
+				issuers, err = nil, nil
 			}
+			checkParse(err)
+		}
+		var attributes *model.PlanAttributes
+		if *attributesFile != "" {
+			attributes, err = source.ReadPlanAttributesFile(*attributesFile, plansOpts)
+			if skipMissing(required, "plan-attributes", err, "its columns are left out", warnings) {
+				attributes, err = nil, nil
+			}
+			checkParse(err)
+		}
+		outputOpts.Columns = append(outputOpts.Columns, explainColumns(r, issuers, attributes)...)
+	}
+	// Check the inputs that could only be hashed once read against the lock
+	if lock != nil && streamed != nil {
+		if err := lock.Verify(hash); err != nil {
+			log.Fatal(err)
 		}
 	}
 
-	return zips, err
-}
+	// Hash the inputs shared by every results file for its metadata
+	var metadata *RunMetadata
+	if *metadataMode != "" {
+		inputs := append([]string{ZipsFileName, PlansFileName}, quarters.files()...)
+		if metadata, err = newRunMetadata(hash, inputs); err != nil {
+			log.Fatalf("Error hashing input files: %v", err)
+		}
+	}
 
-func main() {
-	// Read SlcspFileName to get zip codes to be checked
-	zips, err := parseSlcsp()
-	if err != nil {
-		log.Fatal("Error parsing data from "+SlcspFileName, err)
+	runSummary.mark("prepare output")
+
+	for b, batch := range batches {
+		// Look up each zip code, keeping the line it was read from
+		results := batch.Results
+		chunks := (len(results) + lookupChunkSize - 1) / lookupChunkSize
+		forEach(*workers, chunks, func(chunk int) {
+			end := (chunk + 1) * lookupChunkSize
+			if end > len(results) {
+				end = len(results)
+			}
+			for i := chunk * lookupChunkSize; i < end; i++ {
+				line := results[i].Line
+				if *queryRateAreas {
+					results[i] = r.LookupRateArea(results[i].RateArea)
+				} else {
+					results[i] = r.Lookup(results[i].Zip)
+				}
+				results[i].Line = line
+			}
+		})
+
+		// Keep the benchmarks of thin markets out of the results before anything else sees them
+		applyThinMarkets(r, results, thin)
+
+		// Drop the zip codes the filter doesn't match
+		if filter != nil {
+			matched := results[:0]
+			for _, result := range results {
+				if filter.Match(result) {
+					matched = append(matched, result)
+				}
+			}
+			results = matched
+		}
+		runSummary.count(r, results, thin)
+		runSummary.mark("lookup")
+
+		// Output, with the batch's metadata
+		batchOpts := outputOpts
+		var batchMetadata *RunMetadata
+		if metadata != nil {
+			if batchMetadata, err = metadata.withQuery(hash, batch.Input); err != nil {
+				log.Fatalf("Error hashing input files: %v", err)
+			}
+			if *metadataMode != "sidecar" {
+				batchOpts.Metadata = batchMetadata
+				batchOpts.MetadataTrailer = *metadataMode == "trailer"
+			}
+		}
+		if *signMode == "trailer" {
+			batchOpts.SignKey = signKey
+		}
+		switch {
+		case len(sinks) > 0:
+			err = writeSinks(sinks, results, batchOpts)
+		case *table && batch.Output == "" && !outputOpts.NoHeader && isTerminal(os.Stdout):
+			err = writeTable(os.Stdout, results, batchOpts, os.Getenv("NO_COLOR") == "")
+		default:
+			err = writeResultsFile(batch.Output, results, batchOpts)
+		}
+		if err == nil && *metadataMode == "sidecar" {
+			err = batchMetadata.writeSidecar(batch.Output)
+		}
+		if err == nil && *signMode == "detached" {
+			err = signFile(batch.Output, signKey)
+		}
+		if err != nil {
+			log.Fatalf("Error writing results: %v", err)
+		}
+		batches[b].Results = results
+		runSummary.mark("write")
 	}
 
-	// Create map from slice returned by parseSlcsp
-	zipData := make(map[string]*RateData)
-	for _, zip := range zips {
-		zipData[zip] = &RateData{}
+	// Summarize a directory of results, with the manifest of the inputs they came from
+	if *outputDir != "" {
+		if err := writeBatchIndex(filepath.Join(*outputDir, batchIndexFileName), batches); err != nil {
+			log.Fatalf("Error writing index: %v", err)
+		}
+		if lock != nil {
+			if err := lock.Write(filepath.Join(*outputDir, DatasetLockFileName)); err != nil {
+				log.Fatalf("Error writing dataset lock: %v", err)
+			}
+		}
 	}
 
-	// Read ZipsFileName to get zip to rate area mappings
-	zipData, err = parseZips(zipData)
-	if err != nil {
-		log.Fatal("Error parsing data from "+ZipsFileName, err)
+	// Keep the results for slcsp history
+	if *storeDir != "" {
+		if err := storeResults(*storeDir, time.Now(), batches); err != nil {
+			log.Fatalf("Error storing results: %v", err)
+		}
 	}
 
-	// Read PlansFileName to get rates for each rate area
-	zipData, err = parsePlans(zipData)
-	if err != nil {
-		log.Fatal("Error parsing data from "+PlansFileName, err)
+	// Summarize the run after the results
+	if *showSummary {
+		if err := runSummary.writeFooter(log.Writer()); err != nil {
+			log.Fatalf("Error writing summary: %v", err)
+		}
+	}
+	if *summaryJSON != "" {
+		if err := runSummary.writeJSON(*summaryJSON); err != nil {
+			log.Fatalf("Error writing summary: %v", err)
+		}
+	}
+	if *reportFile != "" {
+		if err := newRunReport(runSummary, readStats).write(*reportFile); err != nil {
+			log.Fatalf("Error writing report: %v", err)
+		}
 	}
 
-	// Output
-	fmt.Println("zipcode,rate")
-	for _, zip := range zips {
-		rateData := zipData[zip]
-		// If no second lowest rate, just output zip
-		if len(rateData.Rates) < 2 {
-			fmt.Println(zip + ",")
-		} else {
-			sort.Float64s(rateData.Rates) // sort least to greatest
-			fmt.Printf("%s,%.2f\n", zip, rateData.Rates[1])
+	// Report any problems after the output, and exit with an error so incomplete results aren't mistaken for complete ones
+	if !summary.Complete {
+		if err := summary.Write(*errorSummaryFile); err != nil {
+			log.Fatalf("Error writing error summary: %v", err)
 		}
+		os.Exit(1)
 	}
 }
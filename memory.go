@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"slcsp/model"
+)
+
+// memoryPerInputByte is roughly how many bytes of memory each byte of the zips and plans files takes once read
+const memoryPerInputByte = 10
+
+// byteSizeUnits are the suffixes of sizes parseByteSize understands, longest first
+var byteSizeUnits = []struct {
+	suffix string
+	bytes  int64
+}{
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"G", 1 << 30},
+	{"M", 1 << 20},
+	{"K", 1 << 10},
+	{"B", 1},
+}
+
+// parseByteSize parses a size such as 512MB, 2G or a plain number of bytes
+func parseByteSize(value string) (int64, error) {
+	number, multiplier := strings.TrimSpace(strings.ToUpper(value)), int64(1)
+	for _, unit := range byteSizeUnits {
+		if strings.HasSuffix(number, unit.suffix) {
+			number, multiplier = strings.TrimSpace(strings.TrimSuffix(number, unit.suffix)), unit.bytes
+			break
+		}
+	}
+	size, err := strconv.ParseFloat(number, 64)
+	if err != nil || size <= 0 {
+		return 0, fmt.Errorf("invalid size %q, expected a number of bytes such as 512MB", value)
+	}
+	return int64(size * float64(multiplier)), nil
+}
+
+// estimateMemory roughly estimates the memory the named input files take once read, from their sizes
+// Files that can't be sized without opening them, such as FIFOs or built in files, count as nothing
+func estimateMemory(names ...string) int64 {
+	total := int64(0)
+	for _, name := range names {
+		if info, err := os.Stat(name); err == nil && info.Mode().IsRegular() {
+			total += info.Size() * memoryPerInputByte
+		}
+	}
+	return total
+}
+
+// zipRateAreas returns the set of rate areas the zip code mappings are in
+func zipRateAreas(zips []model.ZipMapping) map[model.RateArea]bool {
+	rateAreas := make(map[model.RateArea]bool)
+	for _, zip := range zips {
+		rateAreas[zip.RateArea] = true
+	}
+	return rateAreas
+}
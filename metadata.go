@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// Places run metadata can be written: comment lines before or after the results, or a .meta.json file beside them
+var metadataModes = []string{"header", "trailer", "sidecar"}
+
+// RunMetadata describes how a results file was produced, so it stays self describing once archived
+type RunMetadata struct {
+	Version    string       `json:"version"`
+	Generated  time.Time    `json:"generated"`
+	Inputs     []LockedFile `json:"inputs"`
+	Parameters []string     `json:"parameters"`
+}
+
+// toolVersion returns the version the tool was built as, its module version or else its VCS revision
+func toolVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	if info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" {
+			return setting.Value
+		}
+	}
+	return "unknown"
+}
+
+// newRunMetadata hashes the input files a run read, which the metadata of each of its results files shares
+func newRunMetadata(hash hashFunc, inputs []string) (*RunMetadata, error) {
+	metadata := &RunMetadata{
+		Version:    toolVersion(),
+		Generated:  time.Now().UTC().Truncate(time.Second),
+		Inputs:     make([]LockedFile, 0, len(inputs)),
+		Parameters: os.Args[1:],
+	}
+	for _, input := range inputs {
+		locked, err := hash(input)
+		if err != nil {
+			return nil, err
+		}
+		metadata.Inputs = append(metadata.Inputs, locked)
+	}
+	return metadata, nil
+}
+
+// withQuery returns a copy of the metadata with a query file's hash added, unless it's stdin
+func (m *RunMetadata) withQuery(hash hashFunc, query string) (*RunMetadata, error) {
+	copied := *m
+	if query == stdinName {
+		return &copied, nil
+	}
+	locked, err := hash(query)
+	if err != nil {
+		return nil, err
+	}
+	copied.Inputs = append([]LockedFile{locked}, m.Inputs...)
+	return &copied, nil
+}
+
+// writeComments writes the metadata as # comment lines
+func (m *RunMetadata) writeComments(w io.Writer) error {
+	lines := []string{
+		"version: " + m.Version,
+		"generated: " + m.Generated.Format(time.RFC3339),
+		"parameters: " + strings.Join(m.Parameters, " "),
+	}
+	for _, input := range m.Inputs {
+		lines = append(lines, fmt.Sprintf("input: %s sha256 %s", input.Name, input.SHA256))
+	}
+	for _, line := range lines {
+		if _, err := fmt.Fprintf(w, "# %s\n", line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sidecarName returns the name of the .meta.json file beside a results file
+func sidecarName(resultsFile string) string {
+	return strings.TrimSuffix(resultsFile, filepath.Ext(resultsFile)) + ".meta.json"
+}
+
+// writeSidecar writes the metadata as JSON beside a results file
+func (m *RunMetadata) writeSidecar(resultsFile string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(sidecarName(resultsFile), append(data, '\n'), 0644)
+}
@@ -0,0 +1,117 @@
+package model
+
+import "time"
+
+// Plan is a health plan from plans.csv
+// Effective and Expiration are the first and last days its rate is in force, zero when not limited
+// Source labels the file the plan was read from when plans are layered from several files
+type Plan struct {
+	ID         string    `json:"plan_id"`
+	MetalLevel string    `json:"metal_level"`
+	Rate       float64   `json:"rate"`
+	RateArea   RateArea  `json:"rate_area"`
+	Effective  time.Time `json:"effective_date"`
+	Expiration time.Time `json:"expiration_date"`
+	Source     string    `json:"source,omitempty"`
+}
+
+// InForce reports whether the plan's rate is in force on a date
+func (p Plan) InForce(date time.Time) bool {
+	return (p.Effective.IsZero() || !date.Before(p.Effective)) && (p.Expiration.IsZero() || !date.After(p.Expiration))
+}
+
+// Dated reports whether the plan's rate is limited to a range of dates
+func (p Plan) Dated() bool {
+	return !p.Effective.IsZero() || !p.Expiration.IsZero()
+}
+
+// issuerIDLength is the length of the HIOS issuer ID that starts every plan ID
+const issuerIDLength = 5
+
+// IssuerID returns the HIOS issuer ID of the plan, taken from the start of its ID
+func (p Plan) IssuerID() string {
+	if len(p.ID) < issuerIDLength {
+		return p.ID
+	}
+	return p.ID[:issuerIDLength]
+}
+
+// Variant splits the plan ID into the base plan ID and its cost-sharing reduction (CSR) variant,
+// e.g. "12345MO0010001" and "04" for "12345MO0010001-04"; the variant is empty for an ID without one
+func (p Plan) Variant() (string, string) {
+	n := len(p.ID)
+	if n < 4 || p.ID[n-3] != '-' || !isDigit(p.ID[n-2]) || !isDigit(p.ID[n-1]) {
+		return p.ID, ""
+	}
+	return p.ID[:n-3], p.ID[n-2:]
+}
+
+// isDigit reports whether c is an ASCII digit
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// ZipMapping maps a zip code to a county and rate area, as found in zips.csv
+// A zip code can have several ZipMapping when it spans counties or rate areas
+type ZipMapping struct {
+	Zip        string   `json:"zipcode"`
+	CountyCode string   `json:"county_code"`
+	CountyName string   `json:"name"`
+	RateArea   RateArea `json:"rate_area"`
+}
+
+// County is a county a zip code is in, identified by its FIPS code
+type County struct {
+	Code string `json:"county_code"`
+	Name string `json:"name"`
+}
+
+// Result is the second lowest cost silver plan determined for a zip code
+// Rate is nil when no definitive answer can be found
+// RateArea is only set when the zip code maps to exactly one rate area
+// Ambiguous marks whether the zip code maps to multiple rate areas
+// Counties lists every county the zip code is found in
+// Line is the line of the zip code in the query file it was read from
+type Result struct {
+	Zip       string   `json:"zipcode"`
+	Rate      *float64 `json:"rate"`
+	RateArea  RateArea `json:"rate_area"`
+	Ambiguous bool     `json:"ambiguous"`
+	Counties  []County `json:"counties,omitempty"`
+	Line      int      `json:"line"`
+}
+
+// PlanAttributes are descriptive columns of plans, such as their names, from a file keyed by plan ID
+// Columns are the attribute names in file order, and Values holds each plan's values in that order
+type PlanAttributes struct {
+	Columns []string
+	Values  map[string][]string
+}
+
+// Lookup returns the attribute values of a plan, falling back to its base plan for a CSR variant
+func (a *PlanAttributes) Lookup(plan Plan) ([]string, bool) {
+	if values, exists := a.Values[plan.ID]; exists {
+		return values, true
+	}
+	base, _ := plan.Variant()
+	values, exists := a.Values[base]
+	return values, exists
+}
+
+// Dataset is a set of zip code mappings and plans that results are determined from
+type Dataset struct {
+	Zips  []ZipMapping
+	Plans []Plan
+}
+
+// RateAreaSummary aggregates the plans available in a rate area
+// Lowest and SecondLowest are the lowest two Silver plan rates, nil when there aren't enough Silver plans
+// Issuers lists the distinct issuer IDs of every plan in the rate area, sorted
+type RateAreaSummary struct {
+	RateArea     RateArea `json:"rate_area"`
+	Plans        int      `json:"plans"`
+	SilverPlans  int      `json:"silver_plans"`
+	Lowest       *float64 `json:"lowest"`
+	SecondLowest *float64 `json:"second_lowest"`
+	Issuers      []string `json:"issuers"`
+}
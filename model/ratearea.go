@@ -0,0 +1,58 @@
+// Package model defines the domain types shared across the slcsp tool
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// RateArea identifies a geographic region in a state that determines a plan's rate
+// State is the `state` and Code is the `rate_area` column from zips.csv/plans.csv
+// Keeping both parts separate means a RateArea can be used as a map key without
+// distinct (state, rate_area) pairs colliding the way a concatenated string can
+type RateArea struct {
+	State string `json:"state"`
+	Code  string `json:"rate_area"`
+}
+
+// String formats the RateArea as a state and number, for example "NY 1"
+func (ra RateArea) String() string {
+	return fmt.Sprintf("%s %s", ra.State, ra.Code)
+}
+
+// Key returns the rate area as a string no other rate area has, for keying files by rate area
+// Unlike String, both parts are quoted, so ("A B", "1") and ("A", "B 1") don't run together into one key
+func (ra RateArea) Key() string {
+	return strconv.Quote(ra.State) + " " + strconv.Quote(ra.Code)
+}
+
+// IsZero reports whether the RateArea has not been set
+func (ra RateArea) IsZero() bool {
+	return ra == RateArea{}
+}
+
+// Normalized returns the rate area with spaces trimmed from both parts, the state upper-cased and leading
+// zeros stripped from the code, so spellings such as "mo" "07" and "MO" "7" are the same rate area
+func (ra RateArea) Normalized() RateArea {
+	code := strings.TrimSpace(ra.Code)
+	if trimmed := strings.TrimLeft(code, "0"); trimmed != "" {
+		code = trimmed
+	} else if code != "" {
+		code = "0"
+	}
+	return RateArea{State: strings.ToUpper(strings.TrimSpace(ra.State)), Code: code}
+}
+
+// Less orders rate areas by state and then by code, comparing codes numerically when both are numbers
+func (ra RateArea) Less(other RateArea) bool {
+	if ra.State != other.State {
+		return ra.State < other.State
+	}
+	code, errA := strconv.Atoi(ra.Code)
+	otherCode, errB := strconv.Atoi(other.Code)
+	if errA == nil && errB == nil && code != otherCode {
+		return code < otherCode
+	}
+	return ra.Code < other.Code
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+)
+
+// optionalInputs are the inputs that only enrich the results, named as their flags are, which are left
+// out with a warning when their file is missing unless -require lists them
+// lock is the default dataset.lock, which is otherwise only checked if it exists
+var optionalInputs = []string{"plan-attributes", "issuers", "lock"}
+
+// parseRequired parses the comma separated inputs of -require
+func parseRequired(value string) (map[string]bool, error) {
+	required := make(map[string]bool)
+	if value == "" {
+		return required, nil
+	}
+	for _, input := range strings.Split(value, ",") {
+		input = strings.TrimSpace(input)
+		if !contains(optionalInputs, input) {
+			return nil, fmt.Errorf("unknown -require %q, expected some of: %s", input, strings.Join(optionalInputs, ", "))
+		}
+		required[input] = true
+	}
+	return required, nil
+}
+
+// skipMissing reports whether err is an optional input's file being missing, warning that what it adds
+// to the results is left out, unless the input is required
+func skipMissing(required map[string]bool, input string, err error, leftOut string, warnings *warningLog) bool {
+	if err == nil || required[input] || !errors.Is(err, fs.ErrNotExist) {
+		return false
+	}
+	warnings.warn(input+": missing", fmt.Sprintf("%v, so %s; add %s to -require to make this an error", err, leftOut, input))
+	return true
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+
+	"slcsp/model"
+	"slcsp/source"
+)
+
+// OutputOptions controls the columns and rows written for the results
+// CountyCode adds a county_code column, with the codes joined by "|" for a zip code in several counties
+// CountyName adds a county_name column in the same way
+// CountyRows writes a row per county for a zip code in several counties, rather than joining them
+// NoHeader leaves out the header row, so only result records are written
+// Columns are added after the others
+// KeyColumn names the first column, which holds each location looked up; it's zipcode if empty
+// Metadata, if set, is written as comment lines before the results, or after them with MetadataTrailer
+// AllRates, if set, gives the rates each result's benchmark was chosen from, for JSON output
+// Blank is written as the rate of a result with none, rather than leaving the field empty
+// CheapestPlans, if set, gives the cheapest plans of each result, writing a row for each with its rank,
+// plan_id and premium
+// RateAreaKeys starts each row with the state and rate_area of its result, for rate area queries, rather than KeyColumn
+// SignKey, if set, is the secret of an HMAC trailer line written after everything else, for -sign trailer
+type OutputOptions struct {
+	CountyCode      bool
+	CountyName      bool
+	CountyRows      bool
+	NoHeader        bool
+	Columns         []outputColumn
+	KeyColumn       string
+	Metadata        *RunMetadata
+	MetadataTrailer bool
+	AllRates        func(result model.Result) []float64
+	Blank           string
+	RateAreaKeys    bool
+	CheapestPlans   func(result model.Result) []model.Plan
+	SignKey         []byte
+}
+
+// outputColumn is an extra output column and how to determine its value for a result
+type outputColumn struct {
+	Name  string
+	Value func(result model.Result) string
+}
+
+// countyRows returns the counties to write a separate row for, or a single empty County when
+// the result fits on one row
+func countyRows(result model.Result, opts OutputOptions) []model.County {
+	if !opts.CountyRows || len(result.Counties) == 0 {
+		return []model.County{{}}
+	}
+	return result.Counties
+}
+
+// planRows returns the cheapest plans to write a row for, or a single empty Plan when there are none
+// or they aren't asked for
+func planRows(result model.Result, opts OutputOptions) []model.Plan {
+	if opts.CheapestPlans == nil {
+		return []model.Plan{{}}
+	}
+	if plans := opts.CheapestPlans(result); len(plans) > 0 {
+		return plans
+	}
+	return []model.Plan{{}}
+}
+
+// joinCounties joins the codes or names of counties with "|"
+func joinCounties(counties []model.County, field func(model.County) string) string {
+	values := make([]string, 0, len(counties))
+	for _, county := range counties {
+		values = append(values, field(county))
+	}
+	return strings.Join(values, "|")
+}
+
+// countyCode and countyName select a field of a County for joinCounties
+func countyCode(county model.County) string { return county.Code }
+func countyName(county model.County) string { return county.Name }
+
+// resultRow is a row of output and the result it was written for
+type resultRow struct {
+	Result model.Result
+	Record []string
+}
+
+// resultRows returns the header and rows the results are written as, in the order given
+// A result with no rate has its rate left blank, or set to opts.Blank
+func resultRows(results []model.Result, opts OutputOptions) ([]string, []resultRow) {
+	// -county-rows on its own still needs a column to tell the rows apart
+	withCode := opts.CountyCode || (opts.CountyRows && !opts.CountyName)
+
+	keyColumn := opts.KeyColumn
+	if keyColumn == "" {
+		keyColumn = "zipcode"
+	}
+	header := []string{keyColumn, "rate"}
+	if opts.RateAreaKeys {
+		header = []string{source.ColState, source.ColRateArea, "rate"}
+	}
+	if opts.CheapestPlans != nil {
+		header = append(header, "rank", "plan_id", "premium")
+	}
+	if withCode {
+		header = append(header, "county_code")
+	}
+	if opts.CountyName {
+		header = append(header, "county_name")
+	}
+	for _, column := range opts.Columns {
+		header = append(header, column.Name)
+	}
+
+	rows := make([]resultRow, 0, len(results))
+	for _, result := range results {
+		rate := formatRate(result.Rate)
+		if result.Rate == nil {
+			rate = opts.Blank
+		}
+		for _, county := range countyRows(result, opts) {
+			for rank, plan := range planRows(result, opts) {
+				record := []string{result.Zip, rate}
+				if opts.RateAreaKeys {
+					record = []string{result.RateArea.State, result.RateArea.Code, rate}
+				}
+				if opts.CheapestPlans != nil {
+					if plan.ID == "" {
+						record = append(record, "", "", "")
+					} else {
+						record = append(record, strconv.Itoa(rank+1), plan.ID, formatRate(&plan.Rate))
+					}
+				}
+				if withCode {
+					if opts.CountyRows {
+						record = append(record, county.Code)
+					} else {
+						record = append(record, joinCounties(result.Counties, countyCode))
+					}
+				}
+				if opts.CountyName {
+					if opts.CountyRows {
+						record = append(record, county.Name)
+					} else {
+						record = append(record, joinCounties(result.Counties, countyName))
+					}
+				}
+				for _, column := range opts.Columns {
+					record = append(record, column.Value(result))
+				}
+				rows = append(rows, resultRow{Result: result, Record: record})
+			}
+		}
+	}
+
+	return header, rows
+}
+
+// writeResults writes the results as CSV
+func writeResults(w io.Writer, results []model.Result, opts OutputOptions) error {
+	if opts.SignKey != nil {
+		unsigned := opts
+		unsigned.SignKey = nil
+		return writeSigned(w, opts.SignKey, func(w io.Writer) error { return writeResults(w, results, unsigned) })
+	}
+	if opts.Metadata != nil && !opts.MetadataTrailer {
+		if err := opts.Metadata.writeComments(w); err != nil {
+			return err
+		}
+	}
+	writer := csv.NewWriter(w)
+	header, rows := resultRows(results, opts)
+	if !opts.NoHeader {
+		writer.Write(header)
+	}
+	for _, row := range rows {
+		writer.Write(row.Record)
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	if opts.Metadata != nil && opts.MetadataTrailer {
+		return opts.Metadata.writeComments(w)
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"slcsp/model"
+)
+
+// benchmarkPool returns whether a plan is one the benchmark is chosen from: its metal level is one of
+// metals, ignoring case, and neither its ID nor its metal level matches exclude, if given
+func benchmarkPool(metals []string, exclude *regexp.Regexp) func(model.Plan) bool {
+	return func(plan model.Plan) bool {
+		allowed := false
+		for _, metal := range metals {
+			allowed = allowed || strings.EqualFold(plan.MetalLevel, metal)
+		}
+		if !allowed {
+			return false
+		}
+		return exclude == nil || !(exclude.MatchString(plan.ID) || exclude.MatchString(plan.MetalLevel))
+	}
+}
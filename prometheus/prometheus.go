@@ -0,0 +1,130 @@
+// Package prometheus adapts the metrics of a resolver.Resolver to Prometheus, serving them in its text
+// exposition format without depending on a Prometheus client library
+//
+//	metrics := prometheus.New("slcsp")
+//	r, err := resolver.Open(ctx, resolver.WithSources(files), resolver.WithMetrics(metrics))
+//	http.Handle("/metrics", metrics)
+package prometheus
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"slcsp/resolver"
+)
+
+var _ resolver.Metrics = (*Metrics)(nil)
+
+// Metrics collects the counters and timers of a Resolver, implementing resolver.Metrics
+// Counters are exposed as name_total and timers as summaries, name_seconds_sum and name_seconds_count,
+// each prefixed by the namespace
+type Metrics struct {
+	namespace string
+	// counters holds an *atomic.Int64 for each counter, so lookups counting from many goroutines don't contend
+	counters sync.Map
+	mu       sync.Mutex
+	timers   map[string]*timer
+}
+
+// timer is the total and number of the durations observed by a timer
+type timer struct {
+	sum   time.Duration
+	count int64
+}
+
+// New returns Metrics exposed under the namespace given, such as "slcsp"
+func New(namespace string) *Metrics {
+	return &Metrics{namespace: namespace, timers: make(map[string]*timer)}
+}
+
+// Add adds n to the named counter
+func (m *Metrics) Add(name string, n int64) {
+	counter, exists := m.counters.Load(name)
+	if !exists {
+		counter, _ = m.counters.LoadOrStore(name, new(atomic.Int64))
+	}
+	counter.(*atomic.Int64).Add(n)
+}
+
+// Observe records a duration of the named timer
+func (m *Metrics) Observe(name string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, exists := m.timers[name]
+	if !exists {
+		t = &timer{}
+		m.timers[name] = t
+	}
+	t.sum += d
+	t.count++
+}
+
+// WriteTo writes every counter and timer in the Prometheus text exposition format, sorted by name
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	counters := make(map[string]int64)
+	m.counters.Range(func(name, counter any) bool {
+		counters[name.(string)] = counter.(*atomic.Int64).Load()
+		return true
+	})
+	m.mu.Lock()
+	timers := make(map[string]timer, len(m.timers))
+	for name, t := range m.timers {
+		timers[name] = *t
+	}
+	m.mu.Unlock()
+
+	counted := &countingWriter{w: w}
+	b := bufio.NewWriter(counted)
+	for _, name := range sortedNames(counters) {
+		metric := m.name(name) + "_total"
+		fmt.Fprintf(b, "# TYPE %s counter\n%s %d\n", metric, metric, counters[name])
+	}
+	for _, name := range sortedNames(timers) {
+		metric := m.name(name) + "_seconds"
+		fmt.Fprintf(b, "# TYPE %s summary\n%s_sum %g\n%s_count %d\n", metric, metric, timers[name].sum.Seconds(), metric, timers[name].count)
+	}
+	err := b.Flush()
+	return counted.n, err
+}
+
+// ServeHTTP serves the metrics for Prometheus to scrape
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+// name prefixes a metric's name with the namespace
+func (m *Metrics) name(name string) string {
+	if m.namespace == "" {
+		return name
+	}
+	return m.namespace + "_" + name
+}
+
+// sortedNames returns the keys of a map of metrics in order
+func sortedNames[V any](metrics map[string]V) []string {
+	names := make([]string, 0, len(metrics))
+	for name := range metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// countingWriter counts the bytes written through it, for WriteTo
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
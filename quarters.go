@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"slcsp/model"
+	"slcsp/resolver"
+)
+
+// planLayer is a labeled plans file layered over the plans read before it, such as a quarter's rate filing
+type planLayer struct {
+	Label string
+	File  string
+}
+
+// layersFlag is a repeatable flag.Value for plan layers in the order given, e.g. `Q2=plans_q2.csv`
+type layersFlag []planLayer
+
+func (f *layersFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	layers := make([]string, 0, len(*f))
+	for _, layer := range *f {
+		layers = append(layers, layer.Label+"="+layer.File)
+	}
+	return strings.Join(layers, " ")
+}
+
+func (f *layersFlag) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("%q should be in the form label=plans.csv", value)
+	}
+	*f = append(*f, planLayer{Label: parts[0], File: parts[1]})
+	return nil
+}
+
+// files returns the file of each layer
+func (f layersFlag) files() []string {
+	files := make([]string, 0, len(f))
+	for _, layer := range f {
+		files = append(files, layer.File)
+	}
+	return files
+}
+
+// planKey identifies a plan's rate in a rate area
+type planKey struct {
+	ID       string
+	RateArea model.RateArea
+}
+
+// layerPlans combines the plans of several files, earliest first
+// The rows of a plan in a later layer replace every row of the same plan and rate area from earlier layers
+func layerPlans(layers [][]model.Plan) []model.Plan {
+	plans := make([]model.Plan, 0)
+	for _, layer := range layers {
+		replaced := make(map[planKey]bool, len(layer))
+		for _, plan := range layer {
+			replaced[planKey{plan.ID, plan.RateArea}] = true
+		}
+
+		kept := plans[:0]
+		for _, plan := range plans {
+			if !replaced[planKey{plan.ID, plan.RateArea}] {
+				kept = append(kept, plan)
+			}
+		}
+		plans = append(kept, layer...)
+	}
+	return plans
+}
+
+// rateSourceColumn is an output column naming the files the plans setting each benchmark rate came from
+func rateSourceColumn(r *resolver.Resolver) outputColumn {
+	return outputColumn{
+		Name: "rate_source",
+		Value: func(result model.Result) string {
+			if result.Rate == nil {
+				return ""
+			}
+			sources := make([]string, 0, 1)
+			for _, plan := range r.BenchmarkPlans(result.RateArea) {
+				if !contains(sources, plan.Source) {
+					sources = append(sources, plan.Source)
+				}
+			}
+			return strings.Join(sources, "|")
+		},
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"slcsp/model"
+	"slcsp/resolver"
+	"slcsp/source"
+)
+
+// sampleZipCount is the number of representative zip codes listed for each rate area in the ranking
+const sampleZipCount = 3
+
+// runRank implements the `rank` command, ranking the rate areas with the cheapest and most expensive
+// benchmarks nationally
+func runRank(args []string) error {
+	flags := flag.NewFlagSet("rank", flag.ExitOnError)
+	top := flags.Int("top", 10, "number of rate areas at each end of the ranking")
+	zips := flags.String("zips", ZipsFileName, "zips file to read")
+	plans := flags.String("plans", PlansFileName, "plans file to read")
+	flags.Parse(args)
+
+	if *top < 1 {
+		return fmt.Errorf("-top must be at least 1")
+	}
+
+	r, err := resolver.Load(context.Background(), source.Files{Zips: *zips, Plans: *plans})
+	if err != nil {
+		return err
+	}
+
+	// Rank the rate areas that have a benchmark and zip codes to show for it, cheapest first
+	// Rate areas with plans but no zip codes can't be looked up, so they'd only crowd out those that can
+	zipsByArea := zipsByRateArea(r)
+	ranked := make([]model.RateAreaSummary, 0)
+	for _, summary := range r.RateAreaSummaries() {
+		if summary.SecondLowest != nil && len(zipsByArea[summary.RateArea]) > 0 {
+			ranked = append(ranked, summary)
+		}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return *ranked[i].SecondLowest < *ranked[j].SecondLowest
+	})
+
+	cheapest := ranked
+	if len(cheapest) > *top {
+		cheapest = cheapest[:*top]
+	}
+	expensive := make([]model.RateAreaSummary, 0, *top)
+	for i := len(ranked) - 1; i >= 0 && len(expensive) < *top; i-- {
+		expensive = append(expensive, ranked[i])
+	}
+
+	writer := csv.NewWriter(os.Stdout)
+	writer.Write([]string{"ranking", "rank", "state", "rate_area", "rate", "zipcodes", "sample_zipcodes"})
+	for _, list := range []struct {
+		name      string
+		summaries []model.RateAreaSummary
+	}{{"cheapest", cheapest}, {"most_expensive", expensive}} {
+		for i, summary := range list.summaries {
+			areaZips := zipsByArea[summary.RateArea]
+			samples := areaZips
+			if len(samples) > sampleZipCount {
+				samples = samples[:sampleZipCount]
+			}
+			writer.Write([]string{
+				list.name,
+				strconv.Itoa(i + 1),
+				summary.RateArea.State,
+				summary.RateArea.Code,
+				formatRate(summary.SecondLowest),
+				strconv.Itoa(len(areaZips)),
+				strings.Join(samples, "|"),
+			})
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,123 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"slcsp/model"
+)
+
+// Query is an application for LookupBatch
+// County, the FIPS code of the applicant's county, picks the rate area of a zip code in more than one,
+// which is otherwise ambiguous
+// Ages are the ages of the household members to be covered; with none, the benchmark isn't adjusted
+type Query struct {
+	Zip    string
+	County string
+	Ages   []int
+}
+
+// Result is the answer to a Query: the Result of Lookup, narrowed down by the query's county, with
+// Premium the household's benchmark premium, adjusted by the age curve for each member and summed
+// Premium is nil when there's no benchmark or the query has no ages
+type Result struct {
+	model.Result
+	Premium *float64 `json:"premium"`
+}
+
+// maxRatedChildren is how many children under 21 of a household are rated; younger ones cover at no charge
+const maxRatedChildren = 3
+
+// batchCheckInterval is how many queries LookupBatch answers between checks of its context
+const batchCheckInterval = 1024
+
+// LookupBatch answers many applications in one call, from a single index even if one is reloaded meanwhile
+// The rates of the plans are taken to be those of a 21 year old, whose factor on the age curve is 1
+// If ctx is cancelled the results so far are returned with its error
+func (r *Resolver) LookupBatch(ctx context.Context, queries []Query) ([]Result, error) {
+	idx := r.index()
+	r.metrics.Add(MetricLookups, int64(len(queries)))
+	results := make([]Result, 0, len(queries))
+	for i, query := range queries {
+		if i%batchCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return results, err
+			}
+		}
+		for _, age := range query.Ages {
+			if age < 0 {
+				return results, fmt.Errorf("query %d for zip code %s: age %d is negative", i, query.Zip, age)
+			}
+		}
+
+		result := Result{Result: idx.lookup(query.Zip)}
+		if result.Ambiguous && query.County != "" {
+			idx.narrowToCounty(&result.Result, query.County)
+		}
+		if result.Rate != nil && len(query.Ages) > 0 {
+			premium := idx.config.round(*result.Rate * householdFactor(idx.config.ageCurve, query.Ages))
+			result.Premium = &premium
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// narrowToCounty answers an ambiguous result from the one rate area of the county given, if it has one
+func (idx *index) narrowToCounty(result *model.Result, county string) {
+	areas := idx.countyAreas[result.Zip][county]
+	if len(areas) != 1 {
+		return
+	}
+	result.Ambiguous = false
+	result.RateArea = areas[0]
+	result.Rate = nil
+	if rate, ok := idx.benchmark(areas[0]); ok {
+		rate = idx.config.round(rate)
+		result.Rate = &rate
+	}
+}
+
+// householdFactor returns the sum of the age curve over the members of a household, rating only the
+// oldest maxRatedChildren of those under 21
+func householdFactor(curve func(age int) float64, ages []int) float64 {
+	sorted := append([]int(nil), ages...)
+	sort.Sort(sort.Reverse(sort.IntSlice(sorted)))
+	factor, children := 0.0, 0
+	for _, age := range sorted {
+		if age < 21 {
+			if children == maxRatedChildren {
+				continue
+			}
+			children++
+		}
+		factor += curve(age)
+	}
+	return factor
+}
+
+// defaultAgeCurve holds the federal default age curve from 14, the factor of every younger age, to 64,
+// the factor of every older one
+var defaultAgeCurve = []float64{
+	0.765, 0.833, 0.859, 0.885, 0.913, 0.941, 0.970, // 14 to 20
+	1.000, 1.000, 1.000, 1.000, 1.004, 1.024, 1.048, 1.087, 1.119, 1.135, // 21 to 30
+	1.159, 1.183, 1.198, 1.214, 1.222, 1.230, 1.238, 1.246, 1.262, 1.278, // 31 to 40
+	1.302, 1.325, 1.357, 1.397, 1.444, 1.500, 1.563, 1.635, 1.706, 1.786, // 41 to 50
+	1.865, 1.952, 2.040, 2.135, 2.230, 2.333, 2.437, 2.548, 2.603, 2.714, // 51 to 60
+	2.810, 2.873, 2.952, 3.000, // 61 to 64
+}
+
+// DefaultAgeCurve is the federal default age curve, the factor a 21 year old's rate is multiplied by for
+// a member of the age given
+// Some states have their own curves, or rate every age the same; those are set with WithAgeCurve
+func DefaultAgeCurve(age int) float64 {
+	return defaultAgeCurve[min(max(age, 14), 64)-14]
+}
+
+// WithAgeCurve adjusts the premiums of LookupBatch by another age curve than DefaultAgeCurve
+func WithAgeCurve(curve func(age int) float64) Option {
+	return func(c *config) {
+		c.ageCurve = curve
+	}
+}
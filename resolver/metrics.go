@@ -0,0 +1,41 @@
+package resolver
+
+import "time"
+
+// Metrics receives the counts and timings of a Resolver, for programs embedding it to pass on to whatever
+// metrics stack they use, such as the prometheus package of this module
+// A Resolver calls it from every goroutine looking up at once, so implementations must be safe for
+// concurrent use, and quick, as lookups wait on them
+type Metrics interface {
+	// Add adds n to the named counter
+	Add(name string, n int64)
+	// Observe records a duration of the named timer
+	Observe(name string, d time.Duration)
+}
+
+// Names of the counters and timers a Resolver reports
+// Rows are counted as they're loaded from sources by Open and Reload, not for New, which is given them
+// Errors count failed loads and reloads, and errors passed on from the queries of Results
+const (
+	MetricZipRows  = "zip_rows_parsed"
+	MetricPlanRows = "plan_rows_parsed"
+	MetricLookups  = "lookups"
+	MetricErrors   = "errors"
+	MetricLoad     = "load"
+)
+
+// NopMetrics is the Metrics of a Resolver without WithMetrics, which discards everything
+type NopMetrics struct{}
+
+func (NopMetrics) Add(name string, n int64)             {}
+func (NopMetrics) Observe(name string, d time.Duration) {}
+
+// WithMetrics reports the Resolver's rows parsed, lookups served, errors and load times to metrics
+func WithMetrics(metrics Metrics) Option {
+	return func(c *config) {
+		if metrics == nil {
+			metrics = NopMetrics{}
+		}
+		c.metrics = metrics
+	}
+}
@@ -0,0 +1,171 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"time"
+
+	"slcsp/model"
+)
+
+// Option configures a Resolver
+// Options are applied in order, so a later one overrides an earlier one setting the same thing, and new
+// options can be added without changing the signature of New or Open
+type Option func(*config)
+
+// config holds everything an Option can set
+type config struct {
+	// sources are what Open loads, and Reload reloads when given no others
+	sources []Source
+	// inPool selects the plans benchmarks are chosen from
+	inPool func(model.Plan) bool
+	// rule chooses the benchmarks of states without one of stateRules
+	rule       BenchmarkRule
+	stateRules map[string]BenchmarkRule
+	// minPlans is the number of Silver plans a rate area needs for a benchmark
+	minPlans int
+	// ambiguity is how a zip code in several rate areas is answered
+	ambiguity AmbiguityPolicy
+	// precision is the number of decimal places rates are rounded to, or -1 to leave them as they are
+	precision int
+	// logger, if set, is told about loads and reloads
+	logger *log.Logger
+	// metrics is told about rows, lookups, errors and loads
+	metrics Metrics
+	// ageCurve adjusts the premiums of LookupBatch for each age
+	ageCurve func(age int) float64
+}
+
+// newConfig returns the default configuration with opts applied
+func newConfig(opts []Option) config {
+	c := config{inPool: isSilver, rule: SecondLowest, precision: -1, metrics: NopMetrics{}, ageCurve: DefaultAgeCurve}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+// round rounds a rate to the configured precision
+func (c config) round(rate float64) float64 {
+	if c.precision < 0 {
+		return rate
+	}
+	scale := math.Pow(10, float64(c.precision))
+	return math.Round(rate*scale) / scale
+}
+
+// logf logs to the configured logger, if there is one
+func (c config) logf(format string, args ...any) {
+	if c.logger != nil {
+		c.logger.Printf(format, args...)
+	}
+}
+
+// isSilver is the default benchmark pool
+func isSilver(plan model.Plan) bool {
+	return plan.MetalLevel == "Silver"
+}
+
+// AmbiguityPolicy is how a zip code in more than one rate area is answered
+type AmbiguityPolicy int
+
+// Ambiguity policies; results are marked Ambiguous under all of them
+// AmbiguousBlank, the default, gives no rate, as the right rate area can't be known from the zip code
+// AmbiguousSameRate gives the rate only when every rate area has the same benchmark
+// AmbiguousLowest gives the lowest of the rate areas' benchmarks, if they all have one
+const (
+	AmbiguousBlank AmbiguityPolicy = iota
+	AmbiguousSameRate
+	AmbiguousLowest
+)
+
+// Open builds a Resolver from the sources given by WithSources, which Reload reloads when given no others
+func Open(ctx context.Context, opts ...Option) (*Resolver, error) {
+	r := &Resolver{config: newConfig(opts)}
+	if len(r.sources) == 0 {
+		return nil, errors.New("no sources to load, use WithSources")
+	}
+	start := time.Now()
+	dataset, err := r.load(ctx, r.sources)
+	if err != nil {
+		return nil, err
+	}
+	r.current.Store(newIndex(dataset.Zips, dataset.Plans, r.config))
+	r.metrics.Observe(MetricLoad, time.Since(start))
+	r.logf("loaded %d zip code rows and %d plans", len(dataset.Zips), len(dataset.Plans))
+	return r, nil
+}
+
+// WithSources sets the sources Open loads, in order, such as source.Files
+func WithSources(sources ...Source) Option {
+	return func(c *config) {
+		c.sources = sources
+	}
+}
+
+// WithBenchmarkPool sets which plans a benchmark is chosen from, instead of the plans with a Silver metal level
+func WithBenchmarkPool(inPool func(model.Plan) bool) Option {
+	return func(c *config) {
+		c.inPool = inPool
+	}
+}
+
+// WithMetalLevels chooses benchmarks from the plans of any of the metal levels given, instead of Silver
+func WithMetalLevels(levels ...string) Option {
+	return WithBenchmarkPool(func(plan model.Plan) bool {
+		for _, level := range levels {
+			if plan.MetalLevel == level {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// WithRank chooses the benchmark as the nth lowest rate, instead of the second, in states without
+// their own rule from WithStateRules
+func WithRank(n int) Option {
+	return func(c *config) {
+		c.rule = NthLowest(n)
+	}
+}
+
+// WithStateRules chooses the benchmarks of the rate areas of some states with their own rules, keyed by
+// state, instead of SecondLowest
+func WithStateRules(stateRules map[string]BenchmarkRule) Option {
+	return func(c *config) {
+		c.stateRules = stateRules
+	}
+}
+
+// WithMinPlans leaves rate areas with fewer than n Silver plans without a benchmark,
+// whatever their rule; with 0, the default, only the rule decides, SecondLowest needing two
+func WithMinPlans(n int) Option {
+	return func(c *config) {
+		c.minPlans = n
+	}
+}
+
+// WithAmbiguity sets how zip codes in more than one rate area are answered, instead of AmbiguousBlank
+func WithAmbiguity(policy AmbiguityPolicy) Option {
+	return func(c *config) {
+		c.ambiguity = policy
+	}
+}
+
+// WithPrecision rounds the rates of results to the given number of decimal places
+// Benchmarks are still chosen from the unrounded rates
+func WithPrecision(places int) Option {
+	return func(c *config) {
+		c.precision = places
+	}
+}
+
+// WithLogger logs loads and reloads to logger
+func WithLogger(logger *log.Logger) Option {
+	return func(c *config) {
+		c.logger = logger
+	}
+}
@@ -0,0 +1,133 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"slcsp/model"
+)
+
+// Source supplies the zip code mappings and plans a Resolver is built from
+type Source interface {
+	Load(ctx context.Context) (*model.Dataset, error)
+}
+
+// ReloadStats describes what changed when a Resolver was reloaded
+// Zips and Plans are the number of rows the new index was built from
+// RateAreasAdded and RateAreasRemoved count rate areas that gained their first or lost their last Silver plan
+// BenchmarksChanged counts rate areas in both indexes whose second lowest Silver rate differs
+type ReloadStats struct {
+	Zips              int
+	Plans             int
+	ZipsAdded         int
+	ZipsRemoved       int
+	RateAreasAdded    int
+	RateAreasRemoved  int
+	BenchmarksChanged int
+	Duration          time.Duration
+}
+
+// Load is Open with WithSources and no other options, for callers that only need the defaults; Reload
+// reloads the sources when given no others
+func Load(ctx context.Context, sources ...Source) (*Resolver, error) {
+	return Open(ctx, WithSources(sources...))
+}
+
+// Reload builds a new index from the combined data of every source and swaps it in atomically
+// With no sources given, those the Resolver was loaded from by Open are reloaded; a Resolver
+// built by New has none, so it must be given some
+// Lookups carry on being answered from the old index until the new one is ready
+// If loading fails the old index is kept and the error is returned
+func (r *Resolver) Reload(ctx context.Context, sources ...Source) (ReloadStats, error) {
+	start := time.Now()
+	if len(sources) == 0 {
+		sources = r.sources
+	}
+	if len(sources) == 0 {
+		return ReloadStats{}, errors.New("no sources to reload, the Resolver wasn't loaded from any")
+	}
+
+	dataset, err := r.load(ctx, sources)
+	if err != nil {
+		return ReloadStats{}, err
+	}
+	next := newIndex(dataset.Zips, dataset.Plans, r.config)
+
+	// Don't swap if the caller gave up while the index was being built
+	if err := ctx.Err(); err != nil {
+		return ReloadStats{}, err
+	}
+	previous := r.index()
+	r.current.Store(next)
+
+	stats := compareIndexes(previous, next)
+	stats.Duration = time.Since(start)
+	r.metrics.Observe(MetricLoad, stats.Duration)
+	r.logf("reloaded %d zip code rows and %d plans in %s, %d benchmarks changed", stats.Zips, stats.Plans, stats.Duration, stats.BenchmarksChanged)
+	return stats, nil
+}
+
+// load loads every source in order for Open or Reload, counting the rows loaded or the error
+func (r *Resolver) load(ctx context.Context, sources []Source) (*model.Dataset, error) {
+	dataset, err := loadSources(ctx, sources)
+	if err != nil {
+		r.metrics.Add(MetricErrors, 1)
+		return nil, err
+	}
+	r.metrics.Add(MetricZipRows, int64(len(dataset.Zips)))
+	r.metrics.Add(MetricPlanRows, int64(len(dataset.Plans)))
+	return dataset, nil
+}
+
+// loadSources loads every source in order and combines their data
+func loadSources(ctx context.Context, sources []Source) (*model.Dataset, error) {
+	combined := &model.Dataset{}
+	for _, source := range sources {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		dataset, err := source.Load(ctx)
+		if err != nil {
+			return nil, err
+		}
+		combined.Zips = append(combined.Zips, dataset.Zips...)
+		combined.Plans = append(combined.Plans, dataset.Plans...)
+	}
+	return combined, nil
+}
+
+// compareIndexes counts the differences between the previous and next index
+func compareIndexes(previous *index, next *index) ReloadStats {
+	stats := ReloadStats{Zips: next.zipCount, Plans: next.planCount}
+
+	for zip := range next.areas {
+		if _, exists := previous.areas[zip]; !exists {
+			stats.ZipsAdded++
+		}
+	}
+	for zip := range previous.areas {
+		if _, exists := next.areas[zip]; !exists {
+			stats.ZipsRemoved++
+		}
+	}
+
+	for rateArea := range next.rates {
+		if _, exists := previous.rates[rateArea]; !exists {
+			stats.RateAreasAdded++
+			continue
+		}
+		previousRate, hadRate := previous.benchmark(rateArea)
+		nextRate, hasRate := next.benchmark(rateArea)
+		if hadRate != hasRate || previousRate != nextRate {
+			stats.BenchmarksChanged++
+		}
+	}
+	for rateArea := range previous.rates {
+		if _, exists := next.rates[rateArea]; !exists {
+			stats.RateAreasRemoved++
+		}
+	}
+
+	return stats
+}
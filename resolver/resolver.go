@@ -0,0 +1,359 @@
+// Package resolver determines the second lowest cost silver plan (SLCSP) for zip codes
+//
+// Programs embedding it build a Resolver with Open and whichever options they need, for example
+//
+//	r, err := resolver.Open(ctx,
+//		resolver.WithSources(source.Files{Zips: "zips.csv", Plans: "plans.csv"}),
+//		resolver.WithPrecision(2),
+//		resolver.WithLogger(log.Default()))
+//
+// Data bundled into the program, such as in an embed.FS, is loaded by setting the FS of source.Files, so
+// nothing touches the operating system's filesystem, for sandboxed, WASM or serverless environments
+package resolver
+
+import (
+	"sort"
+	"sync/atomic"
+
+	"slcsp/model"
+)
+
+// Resolver answers SLCSP lookups from an index of zip code mappings and plans
+// An index is built once and never modified afterwards; Reload swaps in a whole new one
+// atomically, so a Resolver is safe to use from many goroutines at once without any locking
+// The Silver plans a benchmark is chosen from can be changed with WithBenchmarkPool; the rest of this
+// package calls the plans in the pool Silver plans
+// Benchmarks are the second lowest rate unless a state has its own rule from WithStateRules
+// Everything else about how it works is set with an Option, described in options.go
+type Resolver struct {
+	current atomic.Value // *index
+	config
+}
+
+// index holds the data lookups are answered from
+type index struct {
+	// areas holds the distinct rate areas each zip code is found in
+	areas map[string][]model.RateArea
+	// counties holds the distinct counties each zip code is found in
+	counties map[string][]model.County
+	// countyAreas holds the distinct rate areas of each county of the zip codes in more than one rate area,
+	// by zip code and county code, so a county can pick between them
+	countyAreas map[string]map[string][]model.RateArea
+	// rates holds the Silver plan rates of each rate area, sorted least to greatest, with a rate for each plan
+	rates map[model.RateArea][]float64
+	// silverPlans holds the Silver plans of each rate area
+	silverPlans map[model.RateArea][]model.Plan
+	// planCounts and silverCounts hold the number of plans of any metal level, and of Silver plans, in each rate area
+	planCounts   map[model.RateArea]int
+	silverCounts map[model.RateArea]int
+	// issuers holds the distinct issuer IDs of the plans in each rate area, sorted
+	issuers map[model.RateArea][]string
+	// config is how the Resolver was configured when the index was built
+	config config
+	// zipCount and planCount are the number of rows the index was built from
+	zipCount  int
+	planCount int
+}
+
+// New builds a Resolver from zip code to rate area mappings and plans
+func New(zips []model.ZipMapping, plans []model.Plan, opts ...Option) *Resolver {
+	r := &Resolver{config: newConfig(opts)}
+	r.current.Store(newIndex(zips, plans, r.config))
+	return r
+}
+
+// newIndex builds the index for a set of zip code mappings and plans, choosing the Silver plans and
+// benchmarks as configured
+func newIndex(zips []model.ZipMapping, plans []model.Plan, config config) *index {
+	idx := &index{
+		areas:        make(map[string][]model.RateArea),
+		counties:     make(map[string][]model.County),
+		countyAreas:  make(map[string]map[string][]model.RateArea),
+		rates:        make(map[model.RateArea][]float64),
+		silverPlans:  make(map[model.RateArea][]model.Plan),
+		planCounts:   make(map[model.RateArea]int),
+		silverCounts: make(map[model.RateArea]int),
+		issuers:      make(map[model.RateArea][]string),
+		config:       config,
+		zipCount:     len(zips),
+		planCount:    len(plans),
+	}
+
+	// Track every distinct rate area and county of each zip
+	for _, zip := range zips {
+		if !containsArea(idx.areas[zip.Zip], zip.RateArea) {
+			idx.areas[zip.Zip] = append(idx.areas[zip.Zip], zip.RateArea)
+		}
+		// Locations keyed by something other than zip code may have no counties
+		if zip.CountyCode != "" && !containsCounty(idx.counties[zip.Zip], zip.CountyCode) {
+			idx.counties[zip.Zip] = append(idx.counties[zip.Zip], model.County{Code: zip.CountyCode, Name: zip.CountyName})
+		}
+	}
+
+	// The rate areas of each county of the zip codes in several rate areas
+	for _, zip := range zips {
+		if len(idx.areas[zip.Zip]) < 2 || zip.CountyCode == "" {
+			continue
+		}
+		if idx.countyAreas[zip.Zip] == nil {
+			idx.countyAreas[zip.Zip] = make(map[string][]model.RateArea)
+		}
+		if areas := idx.countyAreas[zip.Zip][zip.CountyCode]; !containsArea(areas, zip.RateArea) {
+			idx.countyAreas[zip.Zip][zip.CountyCode] = append(areas, zip.RateArea)
+		}
+	}
+
+	// Collect the Silver plan rates, plan counts and issuers for each rate area
+	for _, plan := range plans {
+		if config.inPool(plan) {
+			idx.rates[plan.RateArea] = append(idx.rates[plan.RateArea], plan.Rate)
+			idx.silverPlans[plan.RateArea] = append(idx.silverPlans[plan.RateArea], plan)
+			idx.silverCounts[plan.RateArea]++
+		}
+		idx.planCounts[plan.RateArea]++
+		if issuer := plan.IssuerID(); !containsString(idx.issuers[plan.RateArea], issuer) {
+			idx.issuers[plan.RateArea] = append(idx.issuers[plan.RateArea], issuer)
+		}
+	}
+	for _, areaRates := range idx.rates {
+		sort.Float64s(areaRates) // sort least to greatest
+	}
+	for _, areaIssuers := range idx.issuers {
+		sort.Strings(areaIssuers)
+	}
+
+	return idx
+}
+
+// index returns the index currently in use
+func (r *Resolver) index() *index {
+	return r.current.Load().(*index)
+}
+
+// Lookup determines the SLCSP for a zip code
+// If the zip code is in more than one rate area the Result is marked as ambiguous and has no Rate
+// If its rate area has fewer than two Silver plans the Result has no Rate
+func (r *Resolver) Lookup(zip string) model.Result {
+	r.metrics.Add(MetricLookups, 1)
+	return r.index().lookup(zip)
+}
+
+// lookup determines the SLCSP for a zip code from the index
+func (idx *index) lookup(zip string) model.Result {
+	result := model.Result{Zip: zip}
+	if counties := idx.counties[zip]; len(counties) > 0 {
+		result.Counties = append(make([]model.County, 0, len(counties)), counties...)
+	}
+
+	areas := idx.areas[zip]
+	if len(areas) > 1 {
+		result.Ambiguous = true
+		if rate, ok := idx.ambiguousBenchmark(areas); ok {
+			result.Rate = &rate
+		}
+		return result
+	}
+	if len(areas) == 0 {
+		return result
+	}
+	result.RateArea = areas[0]
+
+	// If no second lowest rate, leave the rate unset
+	if rate, ok := idx.benchmark(result.RateArea); ok {
+		rate = idx.config.round(rate)
+		result.Rate = &rate
+	}
+
+	return result
+}
+
+// ambiguousBenchmark returns the benchmark of a zip code in several rate areas under the ambiguity policy
+func (idx *index) ambiguousBenchmark(areas []model.RateArea) (float64, bool) {
+	if idx.config.ambiguity == AmbiguousBlank {
+		return 0, false
+	}
+	rates := make([]float64, 0, len(areas))
+	for _, rateArea := range areas {
+		rate, ok := idx.benchmark(rateArea)
+		if !ok {
+			return 0, false
+		}
+		rates = append(rates, rate)
+	}
+	sort.Float64s(rates)
+	if idx.config.ambiguity == AmbiguousSameRate && rates[0] != rates[len(rates)-1] {
+		return 0, false
+	}
+	return idx.config.round(rates[0]), true
+}
+
+// benchmark returns the second lowest Silver plan rate of a rate area, if it has one, or the
+// benchmark chosen by its state's rule or WithRank, unless it has fewer rates than WithMinPlans
+func (idx *index) benchmark(rateArea model.RateArea) (float64, bool) {
+	if len(idx.rates[rateArea]) < idx.config.minPlans {
+		return 0, false
+	}
+	if rule, exists := idx.config.stateRules[rateArea.State]; exists {
+		return rule.Benchmark(rateArea, idx.rates[rateArea])
+	}
+	return idx.config.rule.Benchmark(rateArea, idx.rates[rateArea])
+}
+
+// LookupRateArea determines the SLCSP of a rate area directly, for callers starting from rate areas rather
+// than zip codes; the Result has no Zip or Counties, and no Rate if the rate area has no benchmark
+func (r *Resolver) LookupRateArea(rateArea model.RateArea) model.Result {
+	r.metrics.Add(MetricLookups, 1)
+	result := model.Result{RateArea: rateArea}
+	idx := r.index()
+	if rate, ok := idx.benchmark(rateArea); ok {
+		rate = idx.config.round(rate)
+		result.Rate = &rate
+	}
+	return result
+}
+
+// BenchmarkPlans returns the Silver plans of a rate area whose rate is its benchmark, sorted by plan ID,
+// or nil if it has no benchmark
+// Several plans share the benchmark rate when they're priced the same
+func (r *Resolver) BenchmarkPlans(rateArea model.RateArea) []model.Plan {
+	idx := r.index()
+	rate, ok := idx.benchmark(rateArea)
+	if !ok {
+		return nil
+	}
+	plans := make([]model.Plan, 0, 1)
+	for _, plan := range idx.silverPlans[rateArea] {
+		if plan.Rate == rate {
+			plans = append(plans, plan)
+		}
+	}
+	sort.SliceStable(plans, func(i, j int) bool {
+		return plans[i].ID < plans[j].ID
+	})
+	return plans
+}
+
+// BenchmarkPlan returns the plan chosen as a rate area's benchmark and how many plans share its rate
+// Of plans priced the same, the one with the lowest plan ID is chosen, so the choice is the same every run
+func (r *Resolver) BenchmarkPlan(rateArea model.RateArea) (model.Plan, int, bool) {
+	plans := r.BenchmarkPlans(rateArea)
+	if len(plans) == 0 {
+		return model.Plan{}, 0, false
+	}
+	return plans[0], len(plans), true
+}
+
+// CheapestPlans returns the n cheapest Silver plans of a rate area, least first, whatever its benchmark
+// rule; plans priced the same are in order of plan ID, as with BenchmarkPlan
+func (r *Resolver) CheapestPlans(rateArea model.RateArea, n int) []model.Plan {
+	areaPlans := r.index().silverPlans[rateArea]
+	plans := append(make([]model.Plan, 0, len(areaPlans)), areaPlans...)
+	sort.SliceStable(plans, func(i, j int) bool {
+		if plans[i].Rate != plans[j].Rate {
+			return plans[i].Rate < plans[j].Rate
+		}
+		return plans[i].ID < plans[j].ID
+	})
+	if len(plans) > n {
+		plans = plans[:n]
+	}
+	return plans
+}
+
+// Zips returns every zip code in the index, sorted
+func (r *Resolver) Zips() []string {
+	idx := r.index()
+	zips := make([]string, 0, len(idx.areas))
+	for zip := range idx.areas {
+		zips = append(zips, zip)
+	}
+	sort.Strings(zips)
+	return zips
+}
+
+// RateAreas returns the distinct rate areas a zip code is found in
+func (r *Resolver) RateAreas(zip string) []model.RateArea {
+	areas := r.index().areas[zip]
+	return append(make([]model.RateArea, 0, len(areas)), areas...)
+}
+
+// RateAreaSummaries aggregates the plans of every rate area found in either the zip code mappings or the plans,
+// sorted by state and rate area
+func (r *Resolver) RateAreaSummaries() []model.RateAreaSummary {
+	idx := r.index()
+
+	rateAreas := make([]model.RateArea, 0, len(idx.planCounts))
+	seen := make(map[model.RateArea]bool)
+	for rateArea := range idx.planCounts {
+		seen[rateArea] = true
+		rateAreas = append(rateAreas, rateArea)
+	}
+	for _, areas := range idx.areas {
+		for _, rateArea := range areas {
+			if !seen[rateArea] {
+				seen[rateArea] = true
+				rateAreas = append(rateAreas, rateArea)
+			}
+		}
+	}
+	sort.Slice(rateAreas, func(i, j int) bool {
+		return rateAreas[i].Less(rateAreas[j])
+	})
+
+	summaries := make([]model.RateAreaSummary, 0, len(rateAreas))
+	for _, rateArea := range rateAreas {
+		areaRates := idx.rates[rateArea]
+		summary := model.RateAreaSummary{
+			RateArea:    rateArea,
+			Plans:       idx.planCounts[rateArea],
+			SilverPlans: idx.silverCounts[rateArea],
+			Issuers:     append(make([]string, 0), idx.issuers[rateArea]...),
+		}
+		if len(areaRates) >= 1 {
+			lowest := areaRates[0]
+			summary.Lowest = &lowest
+		}
+		if secondLowest, ok := idx.benchmark(rateArea); ok {
+			summary.SecondLowest = &secondLowest
+		}
+		summaries = append(summaries, summary)
+	}
+
+	return summaries
+}
+
+// SilverRates returns the Silver plan rates of a rate area, sorted least to greatest, with a rate for each plan
+func (r *Resolver) SilverRates(rateArea model.RateArea) []float64 {
+	areaRates := r.index().rates[rateArea]
+	return append(make([]float64, 0, len(areaRates)), areaRates...)
+}
+
+// containsArea reports whether rateArea is one of areas
+func containsArea(areas []model.RateArea, rateArea model.RateArea) bool {
+	for _, area := range areas {
+		if area == rateArea {
+			return true
+		}
+	}
+	return false
+}
+
+// containsCounty reports whether a county with the code is one of counties
+func containsCounty(counties []model.County, code string) bool {
+	for _, county := range counties {
+		if county.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// containsString reports whether value is one of values
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+package resolver
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"slcsp/model"
+)
+
+// flipSource loads one of two datasets, alternating between them on each load
+type flipSource struct {
+	loads    atomic.Int64
+	datasets [2]*model.Dataset
+}
+
+func (s *flipSource) Load(ctx context.Context) (*model.Dataset, error) {
+	return s.datasets[s.loads.Add(1)%2], nil
+}
+
+// dataset returns zip codes 1 and 2 in rate area MO 1, whose Silver plans have the rates given
+func dataset(rates ...float64) *model.Dataset {
+	area := model.RateArea{State: "MO", Code: "1"}
+	d := &model.Dataset{Zips: []model.ZipMapping{{Zip: "1", RateArea: area}, {Zip: "2", RateArea: area}}}
+	for _, rate := range rates {
+		d.Plans = append(d.Plans, model.Plan{ID: "p", MetalLevel: "Silver", Rate: rate, RateArea: area})
+	}
+	return d
+}
+
+// TestLookupDuringReload looks up zip codes while the index is reloaded over and over, checking every
+// answer is the benchmark of one of the two datasets, and that a batch is answered from only one of them
+// Run it with -race to check the swap of indexes needs no locking
+func TestLookupDuringReload(t *testing.T) {
+	ctx := context.Background()
+	src := &flipSource{datasets: [2]*model.Dataset{dataset(100, 200), dataset(300, 400)}}
+	r, err := Open(ctx, WithSources(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	benchmarks := map[float64]bool{200: true, 400: true}
+
+	// Reload until the readers are done
+	done := make(chan struct{})
+	reloadErr := make(chan error, 1)
+	go func() {
+		for {
+			select {
+			case <-done:
+				reloadErr <- nil
+				return
+			default:
+			}
+			if _, err := r.Reload(ctx); err != nil {
+				reloadErr <- err
+				<-done
+				return
+			}
+		}
+	}()
+
+	const lookups = 2000
+	batch := make([]Query, 64)
+	for i := range batch {
+		batch[i].Zip = []string{"1", "2"}[i%2]
+	}
+	var readers sync.WaitGroup
+	errs := make(chan string, 100)
+	for range 4 {
+		readers.Add(2)
+		go func() {
+			defer readers.Done()
+			for range lookups {
+				if result := r.Lookup("1"); result.Rate == nil || !benchmarks[*result.Rate] {
+					errs <- "Lookup answered from neither index"
+					return
+				}
+			}
+		}()
+		go func() {
+			defer readers.Done()
+			for range lookups {
+				results, err := r.LookupBatch(ctx, batch)
+				if err != nil {
+					errs <- err.Error()
+					return
+				}
+				for _, result := range results {
+					if result.Rate == nil || *result.Rate != *results[0].Rate || !benchmarks[*result.Rate] {
+						errs <- "LookupBatch answered from neither index, or from both"
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	readers.Wait()
+	close(done)
+	if err := <-reloadErr; err != nil {
+		t.Error(err)
+	}
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+// TestReloadWithoutSources checks a Resolver with no sources keeps its index rather than swapping in an empty one
+func TestReloadWithoutSources(t *testing.T) {
+	d := dataset(100, 200)
+	r := New(d.Zips, d.Plans)
+	if _, err := r.Reload(context.Background()); err == nil {
+		t.Error("Reload with no sources succeeded")
+	}
+	if result := r.Lookup("1"); result.Rate == nil || *result.Rate != 200 {
+		t.Errorf("Lookup after a failed Reload = %v, want the benchmark of the index kept", result.Rate)
+	}
+}
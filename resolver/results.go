@@ -0,0 +1,35 @@
+package resolver
+
+import (
+	"context"
+	"iter"
+
+	"slcsp/model"
+)
+
+// Results looks up the zip code of each query as it's iterated, such as from source.Queries, yielding
+// its Result with the query's Line, so a huge set of results can be streamed rather than held in memory
+// Errors from queries are passed on; if ctx is cancelled, its error is yielded and the iteration ends
+func (r *Resolver) Results(ctx context.Context, queries iter.Seq2[model.Result, error]) iter.Seq2[model.Result, error] {
+	return func(yield func(model.Result, error) bool) {
+		for query, err := range queries {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				yield(model.Result{}, ctxErr)
+				return
+			}
+			if err != nil {
+				r.metrics.Add(MetricErrors, 1)
+				if !yield(model.Result{}, err) {
+					return
+				}
+				continue
+			}
+
+			result := r.Lookup(query.Zip)
+			result.Line = query.Line
+			if !yield(result, nil) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package resolver
+
+import (
+	"sort"
+	"sync"
+
+	"slcsp/model"
+)
+
+// BenchmarkRule chooses the benchmark of a rate area from the rates of its Silver plans, sorted least to
+// greatest with a rate for each plan, returning false if it has none
+// Rules must not modify rates
+type BenchmarkRule interface {
+	Benchmark(rateArea model.RateArea, rates []float64) (float64, bool)
+}
+
+// BenchmarkRuleFunc adapts a function to a BenchmarkRule
+type BenchmarkRuleFunc func(rateArea model.RateArea, rates []float64) (float64, bool)
+
+// Benchmark calls f
+func (f BenchmarkRuleFunc) Benchmark(rateArea model.RateArea, rates []float64) (float64, bool) {
+	return f(rateArea, rates)
+}
+
+// SecondLowest is the standard rule, the second lowest rate
+var SecondLowest = BenchmarkRuleFunc(func(rateArea model.RateArea, rates []float64) (float64, bool) {
+	if len(rates) < 2 {
+		return 0, false
+	}
+	return rates[1], true
+})
+
+// NthLowest is a rule choosing the nth lowest rate, counting from 1, so SecondLowest is NthLowest(2)
+func NthLowest(n int) BenchmarkRule {
+	return BenchmarkRuleFunc(func(rateArea model.RateArea, rates []float64) (float64, bool) {
+		if n < 1 || len(rates) < n {
+			return 0, false
+		}
+		return rates[n-1], true
+	})
+}
+
+// Lowest is a rule choosing the lowest rate, for marketplaces that benchmark against the cheapest Silver plan
+var Lowest = BenchmarkRuleFunc(func(rateArea model.RateArea, rates []float64) (float64, bool) {
+	if len(rates) < 1 {
+		return 0, false
+	}
+	return rates[0], true
+})
+
+// rules holds the benchmark rules registered by name
+var (
+	rulesMu sync.RWMutex
+	rules   = map[string]BenchmarkRule{
+		"second-lowest": SecondLowest,
+		"lowest":        Lowest,
+	}
+)
+
+// RegisterRule makes a benchmark rule available by name, such as for WithStateRules from configuration,
+// replacing any registered under the same name
+func RegisterRule(name string, rule BenchmarkRule) {
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+	rules[name] = rule
+}
+
+// Rule returns the benchmark rule registered under name
+func Rule(name string) (BenchmarkRule, bool) {
+	rulesMu.RLock()
+	defer rulesMu.RUnlock()
+	rule, exists := rules[name]
+	return rule, exists
+}
+
+// RuleNames returns the names of the registered benchmark rules, sorted
+func RuleNames() []string {
+	rulesMu.RLock()
+	defer rulesMu.RUnlock()
+	names := make([]string, 0, len(rules))
+	for name := range rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"slcsp/source"
+)
+
+// RunReport is a JSON report of the resources a run used, for tracking how the tool copes as the input
+// files grow: its memory, garbage collection, the rows read from each file and the time of each stage
+// PeakHeapBytes is the most heap in use at the end of any stage, and PeakRSSBytes the peak resident size
+// of the process as the operating system saw it, where it can be read (Linux)
+type RunReport struct {
+	Seconds         float64                     `json:"seconds"`
+	PeakHeapBytes   uint64                      `json:"peak_heap_bytes"`
+	PeakRSSBytes    uint64                      `json:"peak_rss_bytes,omitempty"`
+	SysBytes        uint64                      `json:"sys_bytes"`
+	TotalAllocBytes uint64                      `json:"total_alloc_bytes"`
+	GC              GCReport                    `json:"gc"`
+	Files           map[string]source.FileStats `json:"files"`
+	Stages          []StageTime                 `json:"stages"`
+}
+
+// GCReport is what the garbage collector did during a run
+type GCReport struct {
+	Cycles       uint32  `json:"cycles"`
+	PauseSeconds float64 `json:"pause_seconds"`
+	CPUFraction  float64 `json:"cpu_fraction"`
+}
+
+// newRunReport reports on a run from its summary's stages and the rows counted in stats
+func newRunReport(s *RunSummary, stats *source.ReadStats) *RunReport {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	report := &RunReport{
+		PeakHeapBytes:   max(s.peakHeap, mem.HeapAlloc),
+		PeakRSSBytes:    peakRSS(),
+		SysBytes:        mem.Sys,
+		TotalAllocBytes: mem.TotalAlloc,
+		GC: GCReport{
+			Cycles:       mem.NumGC,
+			PauseSeconds: float64(mem.PauseTotalNs) / 1e9,
+			CPUFraction:  mem.GCCPUFraction,
+		},
+		Files:  stats.Files(),
+		Stages: s.Stages,
+	}
+	for _, stage := range s.Stages {
+		report.Seconds += stage.Seconds
+	}
+	return report
+}
+
+// peakRSS returns the peak resident set size of the process from /proc/self/status, or 0 if it can't be read
+func peakRSS() uint64 {
+	file, err := os.Open("/proc/self/status")
+	if err != nil {
+		return 0
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		value, found := strings.CutPrefix(scanner.Text(), "VmHWM:")
+		if !found {
+			continue
+		}
+		kb, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimSpace(value), " kB"), 10, 64)
+		if err != nil {
+			return 0
+		}
+		return kb * 1024
+	}
+	return 0
+}
+
+// write writes the report as JSON to the named file, or to stdout after the results if the name is -
+func (report *RunReport) write(fileName string) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if fileName == stdinName {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(fileName, data, 0644)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"slcsp/model"
+	"slcsp/resolver"
+)
+
+// Reasons a zip code's rate is left blank, as counted in a RunSummary
+// A rate area with too_few_plans has some Silver plans, but fewer than its benchmark needs; one that's
+// suppressed has a benchmark, blanked by -suppress-below as a thin market
+const (
+	blankAmbiguous   = "ambiguous"
+	blankNotFound    = "not_found"
+	blankNoPlans     = "no_plans"
+	blankTooFewPlans = "too_few_plans"
+	blankSuppressed  = "suppressed"
+)
+
+// blankReason returns why a result has no rate, or "" if it has one, where thin is how thin markets
+// were suppressed
+func blankReason(r *resolver.Resolver, result model.Result, thin thinMarkets) string {
+	switch {
+	case result.Rate != nil:
+		return ""
+	case result.Ambiguous:
+		return blankAmbiguous
+	case result.RateArea.IsZero():
+		return blankNotFound
+	}
+	plans := len(r.SilverRates(result.RateArea))
+	switch {
+	case plans == 0:
+		return blankNoPlans
+	case thin.Round == 0 && thin.thin(plans) && len(r.BenchmarkPlans(result.RateArea)) > 0:
+		return blankSuppressed
+	default:
+		return blankTooFewPlans
+	}
+}
+
+// RunSummary is a machine-readable summary of a run's results and how long each stage took, so the
+// dashboards of scheduled runs don't need to parse logs
+// Blank counts the zip codes without a rate by reason: ambiguous, not_found in the zips file, no_plans
+// in their rate area, too_few_plans for a benchmark, or suppressed as a thin market
+type RunSummary struct {
+	Zips      int            `json:"zipcodes"`
+	Resolved  int            `json:"resolved"`
+	Blank     map[string]int `json:"blank"`
+	RateAreas int            `json:"rate_areas"`
+	Stages    []StageTime    `json:"stages"`
+	areas     map[model.RateArea]bool
+	last      time.Time
+	// peakHeap is the most heap in use at the end of a stage, sampled only when sampleMemory is set for a RunReport
+	sampleMemory bool
+	peakHeap     uint64
+}
+
+// StageTime is the time a stage of a run took
+type StageTime struct {
+	Name    string  `json:"name"`
+	Seconds float64 `json:"seconds"`
+}
+
+// newRunSummary starts a summary, timing its first stage from now
+func newRunSummary() *RunSummary {
+	return &RunSummary{
+		Blank: map[string]int{blankAmbiguous: 0, blankNotFound: 0, blankNoPlans: 0, blankTooFewPlans: 0, blankSuppressed: 0},
+		areas: make(map[model.RateArea]bool),
+		last:  time.Now(),
+	}
+}
+
+// mark ends the current stage, adding the time since the last mark to the named stage, which is added
+// if it's new so stages repeated for each query file are totalled
+func (s *RunSummary) mark(name string) {
+	now := time.Now()
+	elapsed := now.Sub(s.last).Seconds()
+	s.last = now
+	if s.sampleMemory {
+		var stats runtime.MemStats
+		runtime.ReadMemStats(&stats)
+		s.peakHeap = max(s.peakHeap, stats.HeapAlloc)
+	}
+	for i := range s.Stages {
+		if s.Stages[i].Name == name {
+			s.Stages[i].Seconds += elapsed
+			return
+		}
+	}
+	s.Stages = append(s.Stages, StageTime{Name: name, Seconds: elapsed})
+}
+
+// count adds the results of a query file, looked up with r and with thin markets suppressed by thin, to the summary
+func (s *RunSummary) count(r *resolver.Resolver, results []model.Result, thin thinMarkets) {
+	for _, result := range results {
+		s.Zips++
+		if !result.RateArea.IsZero() {
+			s.areas[result.RateArea] = true
+		}
+		if reason := blankReason(r, result, thin); reason != "" {
+			s.Blank[reason]++
+		} else {
+			s.Resolved++
+		}
+	}
+	s.RateAreas = len(s.areas)
+}
+
+// writeFooter writes the summary as a few lines of text
+func (s *RunSummary) writeFooter(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d zip codes in %d rate areas: %d resolved, %d blank (%d ambiguous, %d not found, %d with no plans, %d with too few plans, %d suppressed)\n",
+		s.Zips, s.RateAreas, s.Resolved, s.Zips-s.Resolved, s.Blank[blankAmbiguous], s.Blank[blankNotFound], s.Blank[blankNoPlans], s.Blank[blankTooFewPlans], s.Blank[blankSuppressed])
+	for _, stage := range s.Stages {
+		fmt.Fprintf(&b, "  %s: %s\n", stage.Name, time.Duration(stage.Seconds*float64(time.Second)).Round(time.Microsecond))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeJSON writes the summary as JSON to the named file, or to stdout after the results if the name is -
+func (s *RunSummary) writeJSON(fileName string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if fileName == stdinName {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(fileName, data, 0644)
+}
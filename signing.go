@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// signModes are the ways -sign can sign results: an HMAC comment line after them, or a .sig file beside them
+var signModes = []string{"trailer", "detached"}
+
+// signatureTrailer starts the comment line holding the HMAC of everything before it in a results file
+const signatureTrailer = "# hmac-sha256: "
+
+// signatureSuffix is added to the name of a results file for the name of its detached signature
+const signatureSuffix = ".sig"
+
+// readSignKey reads the secret results are signed with from a file, ignoring a final line ending so keys
+// saved by an editor still match
+func readSignKey(fileName string) ([]byte, error) {
+	key, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	key = bytes.TrimRight(key, "\r\n")
+	if len(key) == 0 {
+		return nil, fmt.Errorf("%s: the signing key is empty", fileName)
+	}
+	return key, nil
+}
+
+// signature returns the hex encoded HMAC-SHA256 of data
+func signature(key []byte, data []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// writeSigned writes with write, followed by a trailer line with the HMAC of everything written
+func writeSigned(w io.Writer, key []byte, write func(w io.Writer) error) error {
+	mac := hmac.New(sha256.New, key)
+	if err := write(io.MultiWriter(w, mac)); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%s%s\n", signatureTrailer, hex.EncodeToString(mac.Sum(nil)))
+	return err
+}
+
+// signFile writes the detached signature of a results file beside it
+func signFile(fileName string, key []byte) error {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fileName+signatureSuffix, []byte(signature(key, data)+"\n"), 0644)
+}
+
+// verifyFile checks a results file against its detached signature if it has one, or its trailer otherwise
+func verifyFile(fileName string, key []byte) error {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return err
+	}
+
+	var signed []byte
+	var want string
+	detached, err := os.ReadFile(fileName + signatureSuffix)
+	switch {
+	case err == nil:
+		signed, want = data, strings.TrimSpace(string(detached))
+	case errors.Is(err, fs.ErrNotExist):
+		// The trailer must be the last line, so nothing can have been added after it
+		body := bytes.TrimSuffix(data, []byte("\n"))
+		start := bytes.LastIndexByte(body, '\n') + 1
+		trailer, found := strings.CutPrefix(string(body[start:]), signatureTrailer)
+		if !found {
+			return fmt.Errorf("%s: not signed, with no %s%s or signature trailer", fileName, fileName, signatureSuffix)
+		}
+		signed, want = data[:start], trailer
+	default:
+		return err
+	}
+
+	got, err := hex.DecodeString(want)
+	if err != nil {
+		return fmt.Errorf("%s: malformed signature %q", fileName, want)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(signed)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return fmt.Errorf("%s: signature doesn't match; the file was changed after it was signed, or signed with another key", fileName)
+	}
+	return nil
+}
+
+// runVerify implements the `verify` command, checking that results files signed with -sign haven't been edited
+func runVerify(args []string) error {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	keyFile := flags.String("key", "", "file holding the secret the results were signed with")
+	flags.Parse(args)
+	if *keyFile == "" || flags.NArg() == 0 {
+		return fmt.Errorf("usage: slcsp verify -key secret.key results.csv...")
+	}
+
+	key, err := readSignKey(*keyFile)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, fileName := range flags.Args() {
+		if err := verifyFile(fileName, key); err != nil {
+			fmt.Println(err)
+			failed++
+			continue
+		}
+		fmt.Printf("%s: signature OK\n", fileName)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files failed verification", failed, flags.NArg())
+	}
+	return nil
+}
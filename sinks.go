@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"slcsp/model"
+)
+
+// Output formats of a sink
+var sinkFormats = []string{"csv", "json", "ndjson", "summary"}
+
+// sinkContentTypes are the content types results are posted to a webhook with
+var sinkContentTypes = map[string]string{
+	"csv":     "text/csv",
+	"json":    "application/json",
+	"ndjson":  "application/x-ndjson",
+	"summary": "application/json",
+}
+
+// webhookTimeout limits how long posting results to a webhook can take
+const webhookTimeout = 30 * time.Second
+
+// outputSink is a destination for the results in one format
+// Destination is "-" for stdout, an http or https URL to post to, or a file name
+type outputSink struct {
+	Format      string
+	Destination string
+}
+
+// sinksFlag is a repeatable flag.Value for output sinks, e.g. `ndjson:-` or `summary:https://example.com/hook`
+type sinksFlag []outputSink
+
+func (f *sinksFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	sinks := make([]string, 0, len(*f))
+	for _, sink := range *f {
+		sinks = append(sinks, sink.Format+":"+sink.Destination)
+	}
+	return strings.Join(sinks, " ")
+}
+
+func (f *sinksFlag) Set(value string) error {
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return fmt.Errorf("%q should be in the form format:destination", value)
+	}
+	if !contains(sinkFormats, parts[0]) {
+		return fmt.Errorf("unknown format %q, expected one of: %s", parts[0], strings.Join(sinkFormats, ", "))
+	}
+	*f = append(*f, outputSink{Format: parts[0], Destination: parts[1]})
+	return nil
+}
+
+// hasFormat reports whether any sink is in one of the formats
+func (f sinksFlag) hasFormat(formats ...string) bool {
+	for _, sink := range f {
+		if contains(formats, sink.Format) {
+			return true
+		}
+	}
+	return false
+}
+
+// resultCounts summarizes a set of results
+type resultCounts struct {
+	Zips      int `json:"zipcodes"`
+	WithRate  int `json:"with_rate"`
+	Blank     int `json:"blank"`
+	Ambiguous int `json:"ambiguous"`
+}
+
+// countResults counts the results with and without a benchmark
+func countResults(results []model.Result) resultCounts {
+	counts := resultCounts{Zips: len(results)}
+	for _, result := range results {
+		if result.Rate != nil {
+			counts.WithRate++
+		}
+		if result.Ambiguous {
+			counts.Ambiguous++
+		}
+	}
+	counts.Blank = counts.Zips - counts.WithRate
+	return counts
+}
+
+// jsonResult is a result as written in JSON, with the values of any extra output columns, the rates
+// its benchmark was chosen from and its cheapest plans
+type jsonResult struct {
+	model.Result
+	Columns       map[string]string `json:"columns,omitempty"`
+	AllRates      []float64         `json:"all_rates,omitempty"`
+	CheapestPlans []jsonPlan        `json:"cheapest_plans,omitempty"`
+}
+
+// jsonPlan is one of a result's cheapest plans as written in JSON
+type jsonPlan struct {
+	Rank    int     `json:"rank"`
+	PlanID  string  `json:"plan_id"`
+	Premium float64 `json:"premium"`
+}
+
+// jsonResults adds the values of the extra output columns, and the rates if asked for, to results
+func jsonResults(results []model.Result, opts OutputOptions) []jsonResult {
+	out := make([]jsonResult, 0, len(results))
+	for _, result := range results {
+		item := jsonResult{Result: result}
+		if len(opts.Columns) > 0 {
+			item.Columns = make(map[string]string, len(opts.Columns))
+			for _, column := range opts.Columns {
+				item.Columns[column.Name] = column.Value(result)
+			}
+		}
+		if opts.AllRates != nil {
+			item.AllRates = opts.AllRates(result)
+		}
+		if opts.CheapestPlans != nil {
+			for rank, plan := range opts.CheapestPlans(result) {
+				item.CheapestPlans = append(item.CheapestPlans, jsonPlan{Rank: rank + 1, PlanID: plan.ID, Premium: plan.Rate})
+			}
+		}
+		out = append(out, item)
+	}
+	return out
+}
+
+// writeSinkFormat writes the results in a sink's format
+func writeSinkFormat(w io.Writer, format string, results []model.Result, opts OutputOptions) error {
+	switch format {
+	case "csv":
+		return writeResults(w, results, opts)
+	case "json":
+		return json.NewEncoder(w).Encode(jsonResults(results, opts))
+	case "ndjson":
+		encoder := json.NewEncoder(w)
+		for _, result := range jsonResults(results, opts) {
+			if err := encoder.Encode(result); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "summary":
+		return json.NewEncoder(w).Encode(countResults(results))
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
+
+// writeSinks writes the results to every sink
+// Each sink is rendered in full before being sent, so a webhook gets a single complete request
+func writeSinks(sinks []outputSink, results []model.Result, opts OutputOptions) error {
+	for _, sink := range sinks {
+		var buffer bytes.Buffer
+		if err := writeSinkFormat(&buffer, sink.Format, results, opts); err != nil {
+			return err
+		}
+
+		switch {
+		case sink.Destination == "-":
+			if _, err := os.Stdout.Write(buffer.Bytes()); err != nil {
+				return err
+			}
+		case strings.HasPrefix(sink.Destination, "http://") || strings.HasPrefix(sink.Destination, "https://"):
+			if err := postWebhook(sink.Destination, sinkContentTypes[sink.Format], &buffer); err != nil {
+				return err
+			}
+		default:
+			if err := os.WriteFile(sink.Destination, buffer.Bytes(), 0644); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// postWebhook posts a body to a URL, failing unless the response is a success
+func postWebhook(url string, contentType string, body io.Reader) error {
+	client := &http.Client{Timeout: webhookTimeout}
+	response, err := client.Post(url, contentType, body)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("%s: %s", url, response.Status)
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"slcsp/source"
+)
+
+// delimiterNames are the names logged for the delimiters -sniff can find
+var delimiterNames = map[rune]string{',': "commas", '\t': "tabs", ';': "semicolons", '|': "pipes"}
+
+// logSniffed logs how -sniff found an input file to be written, for -verbose
+func logSniffed(sniffed source.Sniffed) {
+	delimiter, exists := delimiterNames[sniffed.Delimiter]
+	if !exists {
+		delimiter = fmt.Sprintf("%q", sniffed.Delimiter)
+	}
+	header := "with a header"
+	if !sniffed.Header {
+		header = "without a header"
+	}
+	log.Printf("%s: read as %s, delimited by %s, %s", sniffed.File, sniffed.Encoding, delimiter, header)
+}
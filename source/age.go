@@ -0,0 +1,30 @@
+package source
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ageMatches reports whether an age column value, an age such as 21, a band such as 0-14 or an open
+// band such as 64 and over, covers age; ok is false if the value can't be read
+// Values with no age, such as the Family Option rows of a Rate PUF, cover no age
+func ageMatches(value string, age int) (matches bool, ok bool) {
+	value = strings.TrimSpace(value)
+	if strings.EqualFold(value, "Family Option") {
+		return false, true
+	}
+	if from, found := strings.CutSuffix(value, " and over"); found {
+		n, err := strconv.Atoi(from)
+		return err == nil && age >= n, err == nil
+	}
+	if from, to, found := strings.Cut(value, "-"); found {
+		low, errLow := strconv.Atoi(from)
+		high, errHigh := strconv.Atoi(to)
+		if errLow != nil || errHigh != nil {
+			return false, false
+		}
+		return age >= low && age <= high, true
+	}
+	n, err := strconv.Atoi(value)
+	return err == nil && n == age, err == nil
+}
@@ -0,0 +1,66 @@
+package source
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+)
+
+// RecordError is a problem with a record in an input file
+// Column is the 1-based position within the line, or 0 when the whole record is at fault
+type RecordError struct {
+	File   string
+	Line   int
+	Column int
+	Err    error
+}
+
+func (e *RecordError) Error() string {
+	if e.Column > 0 {
+		return fmt.Sprintf("%s:%d:%d: %v", e.File, e.Line, e.Column, e.Err)
+	}
+	return fmt.Sprintf("%s:%d: %v", e.File, e.Line, e.Err)
+}
+
+func (e *RecordError) Unwrap() error {
+	return e.Err
+}
+
+// NoDataError is returned for an input file that is empty or has only a header
+type NoDataError struct {
+	File string
+}
+
+func (e *NoDataError) Error() string {
+	return fmt.Sprintf("%s contains no data rows", e.File)
+}
+
+// AgeError is returned for a plans file with a row per plan and age when no reference age is given,
+// as counting every age's rate as a separate plan would give the wrong benchmarks
+type AgeError struct {
+	File string
+}
+
+func (e *AgeError) Error() string {
+	return fmt.Sprintf("%s has an %s column, with a row per plan and age, so a reference age to read it at is needed", e.File, ColAge)
+}
+
+// WrapReadError adds the file name, and the position when known, to an error from a csv.Reader
+func WrapReadError(fileName string, err error) error {
+	var limitErr *LimitError
+	if errors.As(err, &limitErr) {
+		return limitErr
+	}
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return &RecordError{File: fileName, Line: parseErr.Line, Column: parseErr.Column, Err: parseErr.Err}
+	}
+	return fmt.Errorf("%s: %w", fileName, err)
+}
+
+// fieldError creates a RecordError for a field value that can't be used
+// The position of the field is taken from the record most recently read by reader
+func fieldError(fileName string, reader recordReader, field int, column string, value string) error {
+	line, col := reader.FieldPos(field)
+	return &RecordError{File: fileName, Line: line, Column: col, Err: fmt.Errorf("invalid %s %q", column, value)}
+}
@@ -0,0 +1,202 @@
+package source
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"io"
+)
+
+// recordReader is the part of csv.Reader used to read an input file, so a faster parser can stand in for it
+type recordReader interface {
+	Read() ([]string, error)
+	FieldPos(field int) (line int, column int)
+}
+
+// fieldPosition is the line and 1-based byte column a field starts at
+type fieldPosition struct {
+	line   int
+	column int
+}
+
+// fastReader is a recordReader for large, plain CSV files
+// It finds separators with bytes.IndexByte, which is vectorized on common platforms, and reuses its
+// buffers between records so reading allocates little more than one string per record
+// Like csv.Reader with ReuseRecord set, the slice returned by Read is overwritten by the next Read
+type fastReader struct {
+	reader           *bufio.Reader
+	lazyQuotes       bool
+	trimLeadingSpace bool
+	fieldsPerRecord  int
+
+	// line is the number of lines read so far, and lineEnded whether the last one ended with a newline
+	line      int
+	lineEnded bool
+	lineBuf   []byte
+	data      []byte
+	ends      []int
+	positions []fieldPosition
+	record    []string
+}
+
+// newFastReader creates a fastReader for a file read with opts
+func newFastReader(r io.Reader, opts Options) *fastReader {
+	return &fastReader{
+		reader:           bufio.NewReaderSize(r, 64*1024),
+		lazyQuotes:       opts.LazyQuotes,
+		trimLeadingSpace: opts.TrimLeadingSpace,
+	}
+}
+
+// readLine returns the next line without its line ending
+// The line is only valid until the next call
+func (f *fastReader) readLine() ([]byte, error) {
+	line, err := f.reader.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		f.lineBuf = append(f.lineBuf[:0], line...)
+		for err == bufio.ErrBufferFull {
+			line, err = f.reader.ReadSlice('\n')
+			f.lineBuf = append(f.lineBuf, line...)
+		}
+		line = f.lineBuf
+	}
+
+	// The last line needn't end with a newline
+	if err == io.EOF && len(line) > 0 {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	f.line++
+	n := len(line)
+	f.lineEnded = line[n-1] == '\n'
+	if f.lineEnded {
+		line = line[:n-1]
+		if n > 1 && line[n-2] == '\r' {
+			line = line[:n-2]
+		}
+	}
+	return line, nil
+}
+
+// Read reads the next record, skipping empty lines, with the same results and errors as csv.Reader
+func (f *fastReader) Read() ([]string, error) {
+	line, err := f.readLine()
+	for err == nil && len(line) == 0 {
+		line, err = f.readLine()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	f.data = f.data[:0]
+	f.ends = f.ends[:0]
+	f.positions = f.positions[:0]
+	startLine := f.line
+	col := 0
+
+	// fail returns a parse error, counting the fields read before it towards the expected number as csv.Reader does
+	fail := func(err error) ([]string, error) {
+		if f.fieldsPerRecord == 0 {
+			f.fieldsPerRecord = len(f.ends)
+		}
+		return nil, err
+	}
+
+	for {
+		if f.trimLeadingSpace {
+			for col < len(line) && (line[col] == ' ' || line[col] == '\t') {
+				col++
+			}
+		}
+		f.positions = append(f.positions, fieldPosition{line: f.line, column: col + 1})
+
+		if col < len(line) && line[col] == '"' {
+			// Quoted field, which may span lines
+			col++
+			for {
+				i := bytes.IndexByte(line[col:], '"')
+				if i < 0 {
+					f.data = append(f.data, line[col:]...)
+					if f.lineEnded {
+						f.data = append(f.data, '\n')
+					}
+					next, err := f.readLine()
+					if err == io.EOF && f.lazyQuotes {
+						col = len(line)
+						break
+					}
+					if err == io.EOF {
+						return fail(&csv.ParseError{StartLine: startLine, Line: f.line, Column: len(line) + 1, Err: csv.ErrQuote})
+					}
+					if err != nil {
+						return nil, err
+					}
+					line, col = next, 0
+					continue
+				}
+
+				f.data = append(f.data, line[col:col+i]...)
+				col += i + 1
+				switch {
+				case col < len(line) && line[col] == '"':
+					// Escaped quote
+					f.data = append(f.data, '"')
+					col++
+					continue
+				case col == len(line) || line[col] == ',':
+				case f.lazyQuotes:
+					f.data = append(f.data, '"')
+					continue
+				default:
+					return fail(&csv.ParseError{StartLine: startLine, Line: f.line, Column: col, Err: csv.ErrQuote})
+				}
+				break
+			}
+		} else {
+			end := len(line)
+			if i := bytes.IndexByte(line[col:], ','); i >= 0 {
+				end = col + i
+			}
+			field := line[col:end]
+			if i := bytes.IndexByte(field, '"'); i >= 0 && !f.lazyQuotes {
+				return fail(&csv.ParseError{StartLine: startLine, Line: f.line, Column: col + i + 1, Err: csv.ErrBareQuote})
+			}
+			f.data = append(f.data, field...)
+			col = end
+		}
+
+		f.ends = append(f.ends, len(f.data))
+		if col >= len(line) {
+			break
+		}
+		// Skip the comma
+		col++
+	}
+
+	// Slice every field out of a single string
+	text := string(f.data)
+	f.record = f.record[:0]
+	start := 0
+	for _, end := range f.ends {
+		f.record = append(f.record, text[start:end])
+		start = end
+	}
+
+	// Records must have as many fields as the first
+	if f.fieldsPerRecord == 0 {
+		f.fieldsPerRecord = len(f.record)
+	} else if len(f.record) != f.fieldsPerRecord {
+		return f.record, &csv.ParseError{StartLine: startLine, Line: startLine, Column: 1, Err: csv.ErrFieldCount}
+	}
+
+	return f.record, nil
+}
+
+// FieldPos returns the line and column of the start of a field of the record most recently read
+func (f *fastReader) FieldPos(field int) (int, int) {
+	position := f.positions[field]
+	return position.line, position.column
+}
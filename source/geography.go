@@ -0,0 +1,51 @@
+package source
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Geography is a scheme of locations that are mapped to rate areas, US zip codes unless set otherwise
+// Key is the column holding each location in query files and the mapping file, read in place of zipcode
+// NoCounties means the mapping file has no county_code and name columns
+// Everything else about looking up a location's benchmark is the same whatever it's keyed by
+type Geography struct {
+	Name       string
+	Key        string
+	NoCounties bool
+}
+
+// Geographies are the schemes known by name
+// A county is keyed by its FIPS code, so its mapping file's county_code column is the key rather than extra detail
+var Geographies = map[string]Geography{
+	"zip":           {Name: "zip", Key: ColZipcode},
+	"county":        {Name: "county", Key: ColCountyCode, NoCounties: true},
+	"postal-prefix": {Name: "postal-prefix", Key: "postal_prefix", NoCounties: true},
+	"region":        {Name: "region", Key: "region", NoCounties: true},
+}
+
+// LookupGeography returns the named Geography, with its key column renamed to key if given
+func LookupGeography(name string, key string) (Geography, error) {
+	geography, exists := Geographies[name]
+	if !exists {
+		names := make([]string, 0, len(Geographies))
+		for name := range Geographies {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return Geography{}, fmt.Errorf("unknown geography %q, expected one of: %s", name, strings.Join(names, ", "))
+	}
+	if key != "" {
+		geography.Key = key
+	}
+	return geography, nil
+}
+
+// KeyColumn is the name of the column holding each location
+func (g Geography) KeyColumn() string {
+	if g.Key == "" {
+		return ColZipcode
+	}
+	return g.Key
+}
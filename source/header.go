@@ -0,0 +1,205 @@
+package source
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Column names read from query files like slcsp.csv
+const (
+	ColZipcode = "zipcode"
+	ColRate    = "rate"
+)
+
+// Column names read from zips.csv, in addition to ColZipcode
+const (
+	ColState      = "state"
+	ColCountyCode = "county_code"
+	ColName       = "name"
+	ColRateArea   = "rate_area"
+)
+
+// Column names read from plans.csv, in addition to ColState, ColRate and ColRateArea
+const (
+	ColPlanID     = "plan_id"
+	ColMetalLevel = "metal_level"
+)
+
+// Optional columns of plans.csv with the first and last dates a plan's rate is in force, as DateLayout
+const (
+	ColEffectiveDate  = "effective_date"
+	ColExpirationDate = "expiration_date"
+)
+
+// ColAge is the optional column of a plans file with a row per plan and age, such as a CMS Rate PUF,
+// holding an age such as 21, a band such as 0-14 or 64 and over
+const ColAge = "age"
+
+// Column names read from an issuer crosswalk, mapping HIOS issuer IDs to their marketing names
+const (
+	ColIssuerID   = "issuer_id"
+	ColIssuerName = "issuer_name"
+)
+
+// DateLayout is the format of dates in input files
+const DateLayout = "2006-01-02"
+
+// Column layouts assumed for files read without a header row
+var (
+	QueryLayout  = []string{ColZipcode, ColRate}
+	ZipsLayout   = []string{ColZipcode, ColState, ColCountyCode, ColName, ColRateArea}
+	PlansLayout  = []string{ColPlanID, ColState, ColMetalLevel, ColRate, ColRateArea}
+	IssuerLayout = []string{ColIssuerID, ColIssuerName}
+	// RateAreaQueryLayout is the layout of a query file of rate areas rather than zip codes
+	RateAreaQueryLayout = []string{ColState, ColRateArea, ColRate}
+	// GeographyLayout is the layout of a mapping file for a Geography without counties, keyed by its first column
+	GeographyLayout = []string{ColZipcode, ColState, ColRateArea}
+)
+
+// PlansOptional are the optional columns of plans.csv, which are only read from files with a header
+var PlansOptional = []string{ColEffectiveDate, ColExpirationDate, ColAge}
+
+// MissingColumnError is returned when a file's header lacks a column that is needed to parse it
+// Found lists the headers actually in the file and Suggestions any of them that look like a misspelling of Column
+type MissingColumnError struct {
+	File        string
+	Column      string
+	Found       []string
+	Suggestions []string
+}
+
+func (e *MissingColumnError) Error() string {
+	msg := fmt.Sprintf("%s: missing required column %q (found columns: %s)", e.File, e.Column, strings.Join(e.Found, ", "))
+	if len(e.Suggestions) > 0 {
+		msg += fmt.Sprintf("; did you mean %q?", strings.Join(e.Suggestions, `" or "`))
+	}
+	return msg
+}
+
+// header maps column names to their position in a record
+type header map[string]int
+
+// readHeader reads the first record from reader and finds the position of each required column in it
+// A MissingColumnError is returned for the first required column that can't be found
+// Optional columns are in the header only if found
+// Columns renamed in opts.Columns are looked for under their new name, but keyed by their usual name in the header
+// A NoDataError is returned for an empty file
+// If opts.NoHeader is set nothing is read and the columns are assumed to be in the order of layout
+func readHeader(fileName string, reader recordReader, opts Options, layout []string, optional []string, required ...string) (header, error) {
+	if opts.NoHeader {
+		if len(opts.Columns) > 0 {
+			return nil, fmt.Errorf("%s: column names can't be mapped for a file without a header", fileName)
+		}
+		h := make(header)
+		for i, name := range layout {
+			h[name] = i
+		}
+		return h, nil
+	}
+
+	record, err := reader.Read()
+	if err == io.EOF {
+		return nil, &NoDataError{File: fileName}
+	}
+	if err != nil {
+		return nil, WrapReadError(fileName, err)
+	}
+	return findColumns(fileName, record, opts, optional, required...)
+}
+
+// findColumns finds the position of each required and optional column in a header record, as readHeader does
+func findColumns(fileName string, record []string, opts Options, optional []string, required ...string) (header, error) {
+	positions := make(map[string]int)
+	for i, name := range record {
+		name = strings.TrimSpace(name)
+		if _, exists := positions[name]; !exists {
+			positions[name] = i
+		}
+	}
+
+	h := make(header)
+	for _, column := range required {
+		name := opts.columnName(column)
+		position, exists := positions[name]
+		if !exists {
+			return nil, &MissingColumnError{
+				File:        fileName,
+				Column:      name,
+				Found:       record,
+				Suggestions: closeMatches(name, record),
+			}
+		}
+		h[column] = position
+	}
+	for _, column := range optional {
+		if position, exists := positions[opts.columnName(column)]; exists {
+			h[column] = position
+		}
+	}
+
+	return h, nil
+}
+
+// closeMatches returns the candidates that are likely misspellings of name
+// A candidate matches if it's equal ignoring case and punctuation, or within a small edit distance
+func closeMatches(name string, candidates []string) []string {
+	matches := make([]string, 0)
+	normalized := normalizeColumnName(name)
+	for _, candidate := range candidates {
+		normalizedCandidate := normalizeColumnName(candidate)
+		maxDistance := len(normalized) / 3
+		if maxDistance < 1 {
+			maxDistance = 1
+		}
+		if normalizedCandidate == normalized || editDistance(normalized, normalizedCandidate) <= maxDistance {
+			matches = append(matches, candidate)
+		}
+	}
+	return matches
+}
+
+// normalizeColumnName lower-cases a column name and drops anything that isn't a letter or digit
+func normalizeColumnName(name string) string {
+	var b strings.Builder
+	for _, c := range strings.ToLower(name) {
+		if ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min3(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(b)]
+}
+
+// min3 returns the smallest of three ints
+func min3(a int, b int, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
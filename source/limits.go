@@ -0,0 +1,107 @@
+package source
+
+import (
+	"fmt"
+	"io"
+)
+
+// Limits bound how much of an input file is read, so a corrupt or malicious file can't use unbounded memory
+// MaxRecordBytes bounds the bytes of a line, and of a record's fields together
+// MaxFields bounds the fields of a record and MaxRows the records of a file, counting its header
+// Zero means no limit
+type Limits struct {
+	MaxRecordBytes int
+	MaxFields      int
+	MaxRows        int
+}
+
+// Names of limits in a LimitError
+const (
+	LimitRecordBytes = "max-record-bytes"
+	LimitFields      = "max-fields"
+	LimitRows        = "max-rows"
+)
+
+// LimitError is returned when an input file exceeds one of its Limits
+// Reading stops at a LimitError, rather than skipping the record as for a RecordError
+type LimitError struct {
+	File  string
+	Line  int
+	Limit string
+	Max   int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s:%d: exceeds the %s limit of %d", e.File, e.Line, e.Limit, e.Max)
+}
+
+// lineLimitReader fails once a line read through it is longer than max bytes, before a CSV reader
+// would buffer all of it
+type lineLimitReader struct {
+	reader   io.Reader
+	fileName string
+	max      int
+	line     int
+	length   int
+}
+
+func (l *lineLimitReader) Read(p []byte) (int, error) {
+	n, err := l.reader.Read(p)
+	for _, c := range p[:n] {
+		if c == '\n' {
+			l.line++
+			l.length = 0
+			continue
+		}
+		l.length++
+		if l.length > l.max {
+			return 0, &LimitError{File: l.fileName, Line: l.line + 1, Limit: LimitRecordBytes, Max: l.max}
+		}
+	}
+	return n, err
+}
+
+// limitedReader checks each record read against the Limits
+type limitedReader struct {
+	recordReader
+	fileName string
+	limits   Limits
+	rows     int
+}
+
+func (l *limitedReader) Read() ([]string, error) {
+	record, err := l.recordReader.Read()
+	if err != nil {
+		return record, err
+	}
+	l.rows++
+
+	line, _ := l.recordReader.FieldPos(0)
+	if l.limits.MaxRows > 0 && l.rows > l.limits.MaxRows {
+		return nil, &LimitError{File: l.fileName, Line: line, Limit: LimitRows, Max: l.limits.MaxRows}
+	}
+	if l.limits.MaxFields > 0 && len(record) > l.limits.MaxFields {
+		return nil, &LimitError{File: l.fileName, Line: line, Limit: LimitFields, Max: l.limits.MaxFields}
+	}
+	if l.limits.MaxRecordBytes > 0 {
+		size := 0
+		for _, field := range record {
+			size += len(field)
+		}
+		if size > l.limits.MaxRecordBytes {
+			return nil, &LimitError{File: l.fileName, Line: line, Limit: LimitRecordBytes, Max: l.limits.MaxRecordBytes}
+		}
+	}
+	return record, nil
+}
+
+// limitReader creates the record reader for a file with newRecordReader, checked against opts.Limits if it has any
+func limitReader(fileName string, r io.Reader, opts Options, newRecordReader func(io.Reader) recordReader) recordReader {
+	if opts.Limits == (Limits{}) {
+		return newRecordReader(r)
+	}
+	if opts.Limits.MaxRecordBytes > 0 {
+		r = &lineLimitReader{reader: r, fileName: fileName, max: opts.Limits.MaxRecordBytes}
+	}
+	return &limitedReader{recordReader: newRecordReader(r), fileName: fileName, limits: opts.Limits}
+}
@@ -0,0 +1,199 @@
+package source
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+
+	"slcsp/model"
+)
+
+// Options controls how an input file is read
+// NoHeader means the file has no header row, so its first line is data
+// Columns maps a column's usual name to the name it has in the file's header, if different
+// Delimiter separates the fields of the file, a comma if zero
+// LazyQuotes and TrimLeadingSpace are passed on to the file's csv.Reader
+// FastCSV reads the file with a quicker parser than encoding/csv, meant for very large files
+// Zips, if set, limits the rows read from a zips file to the zip codes it contains
+// Limits bound the size of the file
+// Geography is how the locations of query and zips files are keyed, by zip code unless set
+// RateAreas, if set, limits the rows read from a plans file to the rate areas it contains, keeping those
+// spelled differently from one of them too so the difference can be reported
+// NormalizeRateAreas reads rate areas as model.RateArea.Normalized, so files spelling them differently match
+// BadRates is what to do with a plan whose rate is empty, zero or negative
+// Age, if set, is the reference age to read a plans file with a row per plan and age at, skipping its other rows
+// OnError is called with each RecordError met, if set; the record is skipped unless it returns an error to stop with
+// OnWarning is called, if set, with each problem that's skipped without being an error, such as under BadRatesSkip
+// Stats, if set, counts the records parsed and skipped
+// Sniff works out the file's encoding, delimiter and whether it has a header from the start of it, in place
+// of Delimiter and NoHeader, for files exported with whatever settings their team uses; OnSniff, if set, is
+// called with what was found
+// FileLine, if set, maps the line numbers of what's read to those of the file it was read from, as
+// RowReader.FileLine does for the rows read through a row index, so errors give the lines of the file
+type Options struct {
+	NoHeader           bool
+	Columns            map[string]string
+	Delimiter          rune
+	LazyQuotes         bool
+	TrimLeadingSpace   bool
+	FastCSV            bool
+	Zips               *ZipFilter
+	Geography          Geography
+	Limits             Limits
+	RateAreas          map[model.RateArea]bool
+	NormalizeRateAreas bool
+	BadRates           BadRatePolicy
+	Age                int
+	OnError            func(err error) error
+	OnWarning          func(err error)
+	Stats              *ReadStats
+	Sniff              bool
+	OnSniff            func(sniffed Sniffed)
+	FileLine           func(line int) int
+}
+
+// BadRatePolicy is how a plan with an empty, zero or negative rate is handled
+type BadRatePolicy string
+
+// Policies for bad rates; the zero value is BadRatesError
+// BadRatesInclude keeps the plan with the rate as given, reading an empty rate as zero
+const (
+	BadRatesError   BadRatePolicy = "error"
+	BadRatesSkip    BadRatePolicy = "skip"
+	BadRatesInclude BadRatePolicy = "include"
+)
+
+// Check returns an error unless p is one of the policies
+func (p BadRatePolicy) Check() error {
+	switch p {
+	case "", BadRatesError, BadRatesSkip, BadRatesInclude:
+		return nil
+	}
+	return fmt.Errorf("unknown bad rate policy %q, expected %s, %s or %s", p, BadRatesError, BadRatesSkip, BadRatesInclude)
+}
+
+// skipRecord decides whether reading can carry on past err by skipping the record
+// It returns nil when the record should be skipped, or the error to stop reading with
+func (opts Options) skipRecord(err error) error {
+	var recordErr *RecordError
+	if opts.OnError == nil || !errors.As(err, &recordErr) {
+		return err
+	}
+	return opts.OnError(err)
+}
+
+// maxRecordErrors is how many problems with records of a file are collected before reading stops
+const maxRecordErrors = 100
+
+// recordErrors collects the problems with the records of a file read without opts.OnError, so they can all
+// be reported at once rather than only the first
+type recordErrors struct {
+	opts Options
+	errs []error
+}
+
+// skip decides whether reading can carry on past err, like Options.skipRecord
+// Without opts.OnError a RecordError is collected and the record skipped, until there are maxRecordErrors
+func (c *recordErrors) skip(err error) error {
+	var recordErr *RecordError
+	if c.opts.OnError != nil || !errors.As(err, &recordErr) {
+		if err := c.opts.skipRecord(err); err != nil {
+			return err
+		}
+		c.opts.Stats.skipped(err)
+		return nil
+	}
+	c.errs = append(c.errs, err)
+	c.opts.Stats.skipped(err)
+	if len(c.errs) >= maxRecordErrors {
+		return c.err()
+	}
+	return nil
+}
+
+// err joins the problems collected with errors.Join, returning nil if there are none
+func (c *recordErrors) err() error {
+	return errors.Join(c.errs...)
+}
+
+// newReader creates the reader for a file read with opts, a csv.Reader unless opts.FastCSV is set for a
+// comma delimited file, checked against opts.Limits and counted in opts.Stats
+func newReader(fileName string, r io.Reader, opts Options) recordReader {
+	reader := limitReader(fileName, r, opts, func(r io.Reader) recordReader {
+		reader := newParser(r, opts)
+		if opts.FileLine != nil {
+			return &fileLineReader{recordReader: reader, fileLine: opts.FileLine}
+		}
+		return reader
+	})
+	if opts.Stats == nil {
+		return reader
+	}
+	return &countingReader{recordReader: reader, fileName: fileName, stats: opts.Stats, header: !opts.NoHeader}
+}
+
+// newParser creates the record reader that parses a file read with opts, a csv.Reader unless opts.FastCSV
+// is set for a comma delimited file
+func newParser(r io.Reader, opts Options) recordReader {
+	if opts.FastCSV && (opts.Delimiter == 0 || opts.Delimiter == ',') {
+		return newFastReader(r, opts)
+	}
+	reader := csv.NewReader(r)
+	if opts.Delimiter != 0 {
+		reader.Comma = opts.Delimiter
+	}
+	reader.LazyQuotes = opts.LazyQuotes
+	reader.TrimLeadingSpace = opts.TrimLeadingSpace
+	return reader
+}
+
+// fileLineReader gives the line numbers of the records a recordReader reads, and of its errors, as
+// opts.FileLine maps them
+type fileLineReader struct {
+	recordReader
+	fileLine func(line int) int
+}
+
+func (f *fileLineReader) Read() ([]string, error) {
+	record, err := f.recordReader.Read()
+	var parseErr *csv.ParseError
+	var limitErr *LimitError
+	switch {
+	case errors.As(err, &parseErr):
+		mapped := *parseErr
+		mapped.StartLine, mapped.Line = f.fileLine(parseErr.StartLine), f.fileLine(parseErr.Line)
+		err = &mapped
+	case errors.As(err, &limitErr):
+		mapped := *limitErr
+		mapped.Line = f.fileLine(limitErr.Line)
+		err = &mapped
+	}
+	return record, err
+}
+
+func (f *fileLineReader) FieldPos(field int) (int, int) {
+	line, column := f.recordReader.FieldPos(field)
+	return f.fileLine(line), column
+}
+
+// rateArea returns the rate area of a row, normalized if opts.NormalizeRateAreas is set
+func (opts Options) rateArea(state string, code string) model.RateArea {
+	rateArea := model.RateArea{State: state, Code: code}
+	if opts.NormalizeRateAreas {
+		return rateArea.Normalized()
+	}
+	return rateArea
+}
+
+// columnName returns the name the column is expected to have in the file's header
+// The zipcode column is the Geography's key column, unless it's renamed
+func (opts Options) columnName(column string) string {
+	if name, exists := opts.Columns[column]; exists {
+		return name
+	}
+	if column == ColZipcode {
+		return opts.Geography.KeyColumn()
+	}
+	return column
+}
@@ -0,0 +1,501 @@
+// Package source reads the tool's CSV inputs into model types
+package source
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"slcsp/model"
+)
+
+// ReadQueries reads a file shaped like slcsp.csv and returns a Result for each zip code in it
+func ReadQueries(fileName string, r io.Reader, opts Options) ([]model.Result, error) {
+	results := make([]model.Result, 0)
+	for result, err := range Queries(fileName, r, opts) {
+		if err != nil {
+			return results, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// ReadRateAreaQueries reads a query file of rate areas, with state and rate_area columns, and returns a
+// Result with the RateArea set for each, in the order given
+func ReadRateAreaQueries(fileName string, r io.Reader, opts Options) ([]model.Result, error) {
+	results := make([]model.Result, 0)
+	r, opts = opts.sniff(fileName, r, RateAreaQueryLayout...)
+	queryReader := newReader(fileName, r, opts)
+	problems := &recordErrors{opts: opts}
+
+	// Find the columns from the first line (header)
+	// An empty query file has no results rather than being an error
+	h, err := readHeader(fileName, queryReader, opts, RateAreaQueryLayout, nil, ColState, ColRateArea)
+	var noData *NoDataError
+	if errors.As(err, &noData) {
+		return results, nil
+	}
+	if err != nil {
+		return results, err
+	}
+
+	// Read file data
+	for {
+		record, err := queryReader.Read()
+
+		// Stop at end of file
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			if err := problems.skip(WrapReadError(fileName, err)); err != nil {
+				return results, err
+			}
+			continue
+		}
+
+		line, _ := queryReader.FieldPos(h[ColState])
+		rateArea := opts.rateArea(record[h[ColState]], record[h[ColRateArea]])
+		results = append(results, model.Result{RateArea: rateArea, Line: line})
+	}
+
+	return results, problems.err()
+}
+
+// ReadZipList reads a plain text list of zip codes, one per line, and returns a Result for each
+// Surrounding spaces and blank lines are ignored
+func ReadZipList(fileName string, r io.Reader) ([]model.Result, error) {
+	results := make([]model.Result, 0)
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		zip := strings.TrimSpace(scanner.Text())
+		if zip == "" {
+			continue
+		}
+		results = append(results, model.Result{Zip: zip, Line: line})
+	}
+	if err := scanner.Err(); err != nil {
+		return results, fmt.Errorf("%s: %w", fileName, err)
+	}
+	return results, nil
+}
+
+// ReadZips reads a file shaped like zips.csv and returns every zip to rate area mapping in it
+func ReadZips(fileName string, r io.Reader, opts Options) ([]model.ZipMapping, error) {
+	zips := make([]model.ZipMapping, 0)
+	r, opts = opts.sniff(fileName, r, ZipsLayout...)
+	zipsReader := newReader(fileName, r, opts)
+	problems := &recordErrors{opts: opts}
+	rows := 0
+
+	// Find the columns from the first line (header)
+	required := []string{ColZipcode, ColState, ColCountyCode, ColName, ColRateArea}
+	layout := ZipsLayout
+	if opts.Geography.NoCounties {
+		required = []string{ColZipcode, ColState, ColRateArea}
+		layout = GeographyLayout
+	}
+	h, err := readHeader(fileName, zipsReader, opts, layout, nil, required...)
+	if err != nil {
+		return zips, err
+	}
+
+	// Read file data
+	for {
+		record, err := zipsReader.Read()
+
+		// Stop at end of file
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			if err := problems.skip(WrapReadError(fileName, err)); err != nil {
+				return zips, err
+			}
+			continue
+		}
+		rows++
+
+		// Skip zip codes that won't be looked up
+		if opts.Zips != nil && !opts.Zips.Contains(record[h[ColZipcode]]) {
+			continue
+		}
+
+		zip := model.ZipMapping{
+			Zip:      record[h[ColZipcode]],
+			RateArea: opts.rateArea(record[h[ColState]], record[h[ColRateArea]]),
+		}
+		if !opts.Geography.NoCounties {
+			zip.CountyCode = record[h[ColCountyCode]]
+			zip.CountyName = record[h[ColName]]
+		}
+		zips = append(zips, zip)
+	}
+
+	if rows == 0 && len(problems.errs) == 0 {
+		return zips, &NoDataError{File: fileName}
+	}
+	return zips, problems.err()
+}
+
+// ReadPlans reads a file shaped like plans.csv and returns every plan in it
+func ReadPlans(fileName string, r io.Reader, opts Options) ([]model.Plan, error) {
+	plans := make([]model.Plan, 0)
+	r, opts = opts.sniff(fileName, r, append(PlansLayout, PlansOptional...)...)
+	plansReader := newReader(fileName, r, opts)
+	problems := &recordErrors{opts: opts}
+	rows := 0
+
+	// Find the columns from the first line (header)
+	h, err := readHeader(fileName, plansReader, opts, PlansLayout, PlansOptional, ColPlanID, ColState, ColMetalLevel, ColRate, ColRateArea)
+	if err != nil {
+		return plans, err
+	}
+	ageColumn, perAge := h[ColAge]
+	if perAge && opts.Age == 0 {
+		return plans, &AgeError{File: fileName}
+	}
+	if !perAge && opts.Age != 0 {
+		return plans, fmt.Errorf("%s: a reference age was given but there's no %s column to select rows by", fileName, opts.columnName(ColAge))
+	}
+	spellings := make(map[model.RateArea]bool, len(opts.RateAreas))
+	for rateArea := range opts.RateAreas {
+		spellings[rateArea.Normalized()] = true
+	}
+
+	// Read file data
+	for {
+		record, err := plansReader.Read()
+
+		// Stop at end of file
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			if err := problems.skip(WrapReadError(fileName, err)); err != nil {
+				return plans, err
+			}
+			continue
+		}
+		rows++
+
+		// Skip plans in rate areas that won't be looked up, however they're spelled
+		rateArea := opts.rateArea(record[h[ColState]], record[h[ColRateArea]])
+		if opts.RateAreas != nil && !opts.RateAreas[rateArea] && !spellings[rateArea.Normalized()] {
+			continue
+		}
+
+		// Keep only the rows of the reference age from a file with a row per age
+		if perAge {
+			matches, ok := ageMatches(record[ageColumn], opts.Age)
+			if !ok {
+				if err := problems.skip(fieldError(fileName, plansReader, ageColumn, ColAge, record[ageColumn])); err != nil {
+					return plans, err
+				}
+				continue
+			}
+			if !matches {
+				continue
+			}
+		}
+
+		rate, ok, err := readRate(fileName, plansReader, opts, h[ColRate], record[h[ColRate]])
+		if err != nil {
+			if err := problems.skip(err); err != nil {
+				return plans, err
+			}
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		effective, expiration, err := readPlanDates(fileName, plansReader, h, record)
+		if err != nil {
+			if err := problems.skip(err); err != nil {
+				return plans, err
+			}
+			continue
+		}
+
+		plans = append(plans, model.Plan{
+			ID:         record[h[ColPlanID]],
+			MetalLevel: record[h[ColMetalLevel]],
+			Rate:       rate,
+			RateArea:   rateArea,
+			Effective:  effective,
+			Expiration: expiration,
+		})
+	}
+
+	if rows == 0 && len(problems.errs) == 0 {
+		return plans, &NoDataError{File: fileName}
+	}
+	return plans, problems.err()
+}
+
+// readRate parses a plan's rate, applying opts.BadRates to one that's empty, zero or negative
+// It returns false if the plan should be skipped
+func readRate(fileName string, reader recordReader, opts Options, position int, value string) (float64, bool, error) {
+	rate := 0.0
+	if value != "" {
+		var err error
+		rate, err = strconv.ParseFloat(value, 64)
+		if err != nil {
+			return 0, false, fieldError(fileName, reader, position, ColRate, value)
+		}
+	}
+	if rate > 0 {
+		return rate, true, nil
+	}
+
+	switch opts.BadRates {
+	case BadRatesInclude:
+		return rate, true, nil
+	case BadRatesSkip:
+		if opts.OnWarning != nil {
+			opts.OnWarning(fieldError(fileName, reader, position, ColRate, value))
+		}
+		opts.Stats.add(fileName, 0, 1)
+		return 0, false, nil
+	}
+	return 0, false, fieldError(fileName, reader, position, ColRate, value)
+}
+
+// readPlanDates parses the optional effective and expiration dates of a plan, leaving blank or missing ones zero
+func readPlanDates(fileName string, reader recordReader, h header, record []string) (time.Time, time.Time, error) {
+	var dates [2]time.Time
+	for i, column := range []string{ColEffectiveDate, ColExpirationDate} {
+		position, exists := h[column]
+		if !exists || record[position] == "" {
+			continue
+		}
+		date, err := time.Parse(DateLayout, record[position])
+		if err != nil {
+			return time.Time{}, time.Time{}, fieldError(fileName, reader, position, column, record[position])
+		}
+		dates[i] = date
+	}
+	return dates[0], dates[1], nil
+}
+
+// ReadPlanAttributes reads a file of descriptive plan columns keyed by a plan_id column
+// Every other column of its header is an attribute, so the file must have a header to name them
+func ReadPlanAttributes(fileName string, r io.Reader, opts Options) (*model.PlanAttributes, error) {
+	attributes := &model.PlanAttributes{Columns: make([]string, 0), Values: make(map[string][]string)}
+	r, opts = opts.sniff(fileName, r, ColPlanID)
+	if opts.NoHeader {
+		return attributes, fmt.Errorf("%s: a plan attributes file needs a header naming its columns", fileName)
+	}
+	attributesReader := newReader(fileName, r, opts)
+	problems := &recordErrors{opts: opts}
+
+	// Find the plan ID and attribute columns from the first line (header)
+	record, err := attributesReader.Read()
+	if err != nil {
+		return attributes, WrapReadError(fileName, err)
+	}
+	h, err := findColumns(fileName, record, opts, nil, ColPlanID)
+	if err != nil {
+		return attributes, err
+	}
+	positions := make([]int, 0, len(record)-1)
+	for i, name := range record {
+		if i != h[ColPlanID] {
+			attributes.Columns = append(attributes.Columns, strings.TrimSpace(name))
+			positions = append(positions, i)
+		}
+	}
+
+	// Read file data
+	for {
+		record, err := attributesReader.Read()
+
+		// Stop at end of file
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			if err := problems.skip(WrapReadError(fileName, err)); err != nil {
+				return attributes, err
+			}
+			continue
+		}
+
+		values := make([]string, len(positions))
+		for i, position := range positions {
+			values[i] = record[position]
+		}
+		attributes.Values[record[h[ColPlanID]]] = values
+	}
+
+	return attributes, problems.err()
+}
+
+// ReadIssuers reads an issuer crosswalk, returning each issuer ID's marketing name
+func ReadIssuers(fileName string, r io.Reader, opts Options) (map[string]string, error) {
+	issuers := make(map[string]string)
+	r, opts = opts.sniff(fileName, r, IssuerLayout...)
+	issuersReader := newReader(fileName, r, opts)
+	problems := &recordErrors{opts: opts}
+
+	// Find the columns from the first line (header)
+	h, err := readHeader(fileName, issuersReader, opts, IssuerLayout, nil, ColIssuerID, ColIssuerName)
+	if err != nil {
+		return issuers, err
+	}
+
+	// Read file data
+	for {
+		record, err := issuersReader.Read()
+
+		// Stop at end of file
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			if err := problems.skip(WrapReadError(fileName, err)); err != nil {
+				return issuers, err
+			}
+			continue
+		}
+
+		issuers[record[h[ColIssuerID]]] = record[h[ColIssuerName]]
+	}
+
+	return issuers, problems.err()
+}
+
+// ReadIssuersFile opens the named file and reads it with ReadIssuers
+func ReadIssuersFile(fileName string, opts Options) (map[string]string, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return make(map[string]string), err
+	}
+	defer file.Close()
+	return ReadIssuers(fileName, file, opts)
+}
+
+// ReadPlanAttributesFile opens the named file and reads it with ReadPlanAttributes
+func ReadPlanAttributesFile(fileName string, opts Options) (*model.PlanAttributes, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return &model.PlanAttributes{Columns: make([]string, 0), Values: make(map[string][]string)}, err
+	}
+	defer file.Close()
+	return ReadPlanAttributes(fileName, file, opts)
+}
+
+// ReadQueriesFile opens the named file and reads it with ReadQueries
+func ReadQueriesFile(fileName string, opts Options) ([]model.Result, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return make([]model.Result, 0), err
+	}
+	defer file.Close()
+	return ReadQueries(fileName, file, opts)
+}
+
+// ReadZipListFile opens the named file and reads it with ReadZipList
+func ReadZipListFile(fileName string) ([]model.Result, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return make([]model.Result, 0), err
+	}
+	defer file.Close()
+	return ReadZipList(fileName, file)
+}
+
+// ReadZipsFile opens the named file and reads it with ReadZips
+func ReadZipsFile(fileName string, opts Options) ([]model.ZipMapping, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return make([]model.ZipMapping, 0), err
+	}
+	defer file.Close()
+	return ReadZips(fileName, file, opts)
+}
+
+// ReadPlansFile opens the named file and reads it with ReadPlans
+func ReadPlansFile(fileName string, opts Options) ([]model.Plan, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return make([]model.Plan, 0), err
+	}
+	defer file.Close()
+	return ReadPlans(fileName, file, opts)
+}
+
+// Files is a resolver.Source that reads a zips.csv and a plans.csv shaped file
+// Either name may be left empty to only supply the other file's data
+// FS, if set, is opened instead of the operating system's files, such as an embed.FS of data bundled into
+// a program running where there's no filesystem; its names are slash separated, as for fs.FS
+type Files struct {
+	Zips         string
+	Plans        string
+	ZipsOptions  Options
+	PlansOptions Options
+	FS           fs.FS
+}
+
+// open opens one of the named files, from f.FS if it's set
+func (f Files) open(fileName string) (io.ReadCloser, error) {
+	if f.FS != nil {
+		return f.FS.Open(fileName)
+	}
+	return os.Open(fileName)
+}
+
+// Load reads the files into a Dataset
+func (f Files) Load(ctx context.Context) (*model.Dataset, error) {
+	dataset := &model.Dataset{}
+
+	if f.Zips != "" {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		file, err := f.open(f.Zips)
+		if err != nil {
+			return nil, err
+		}
+		zips, err := ReadZips(f.Zips, file, f.ZipsOptions)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+		dataset.Zips = zips
+	}
+
+	if f.Plans != "" {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		file, err := f.open(f.Plans)
+		if err != nil {
+			return nil, err
+		}
+		plans, err := ReadPlans(f.Plans, file, f.PlansOptions)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+		dataset.Plans = plans
+	}
+
+	return dataset, nil
+}
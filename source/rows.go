@@ -0,0 +1,335 @@
+package source
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"slcsp/model"
+)
+
+// RowIndex records where each key's rows are in an input file, so the rows of a few zip codes or rate
+// areas can be read without scanning the rest of the file
+// Size and ModTime identify the version of the file indexed, and Key the column or columns rows are
+// keyed by; Header is the length of the header line, which is read along with any rows
+// Version is the format of the index, rowIndexVersion for one written by this build
+type RowIndex struct {
+	Version int                  `json:"version"`
+	File    string               `json:"file"`
+	Size    int64                `json:"size"`
+	ModTime time.Time            `json:"mod_time"`
+	Key     string               `json:"key"`
+	Header  int64                `json:"header"`
+	Rows    map[string][]RowSpan `json:"-"`
+}
+
+// RowSpan is a run of whole records in a file, as a byte offset, a length and the line it starts on
+type RowSpan [3]int64
+
+// rowIndexVersion is the format of the row indexes written; an index written before spans had their line
+// is version 0, and doesn't match any file until it's rebuilt
+const rowIndexVersion = 1
+
+// RowIndexSuffix is added to the name of an input file for the name of its row index
+const RowIndexSuffix = ".rows"
+
+// IndexZipRows indexes the rows of a zips file by zip code, or by the key of opts.Geography
+func IndexZipRows(fileName string, r io.Reader, opts Options) (*RowIndex, error) {
+	layout := ZipsLayout
+	if opts.Geography.NoCounties {
+		layout = GeographyLayout
+	}
+	return indexRows(fileName, r, opts, ZipRowKey(opts), layout, []string{ColZipcode}, func(h header, record []string) string {
+		return record[h[ColZipcode]]
+	})
+}
+
+// IndexPlanRows indexes the rows of a plans file by rate area, as formatted by model.RateArea.Key
+func IndexPlanRows(fileName string, r io.Reader, opts Options) (*RowIndex, error) {
+	return indexRows(fileName, r, opts, PlanRowKey(opts), PlansLayout, []string{ColState, ColRateArea}, func(h header, record []string) string {
+		return model.RateArea{State: record[h[ColState]], Code: record[h[ColRateArea]]}.Key()
+	})
+}
+
+// ZipRowKey and PlanRowKey describe the columns a zips or plans file's rows are keyed by when read with opts,
+// which its row index must have been built with to be used
+func ZipRowKey(opts Options) string { return opts.columnName(ColZipcode) }
+func PlanRowKey(opts Options) string {
+	return model.RateArea{State: opts.columnName(ColState), Code: opts.columnName(ColRateArea)}.Key()
+}
+
+// indexRows indexes the records of a file by the key of each, merging the spans of consecutive rows
+// The file is parsed as opts would read it, except with encoding/csv whatever opts.FastCSV, as the offsets
+// come from csv.Reader.InputOffset; a file sniffed as other than UTF-8 can't be indexed, as the offsets
+// would be of the decoded text rather than the file
+// Size and ModTime are left for the caller to set from the file's info
+func indexRows(fileName string, r io.Reader, opts Options, keyName string, layout []string, required []string, key func(h header, record []string) string) (*RowIndex, error) {
+	var sniffed *Sniffed
+	onSniff := opts.OnSniff
+	opts.OnSniff = func(s Sniffed) {
+		sniffed = &s
+		if onSniff != nil {
+			onSniff(s)
+		}
+	}
+	r, opts = opts.sniff(fileName, r, layout...)
+	var bom int64
+	if sniffed != nil {
+		if sniffed.Encoding != EncodingUTF8 {
+			return nil, fmt.Errorf("%s: only UTF-8 files can have a row index, not %s", fileName, sniffed.Encoding)
+		}
+		bom = int64(sniffed.BOM)
+	}
+
+	lines := &lineCounter{r: r}
+	opts.FastCSV = false
+	reader := newParser(lines, opts).(*csv.Reader)
+	reader.FieldsPerRecord = -1
+
+	h, err := readHeader(fileName, reader, opts, layout, nil, required...)
+	if err != nil {
+		return nil, err
+	}
+	idx := &RowIndex{Version: rowIndexVersion, File: fileName, Key: keyName, Header: bom + reader.InputOffset(), Rows: make(map[string][]RowSpan)}
+
+	// Offsets are counted in what's read, after any byte order mark, and moved past it as they're stored
+	start := reader.InputOffset()
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, WrapReadError(fileName, err)
+		}
+		end := reader.InputOffset()
+		k := key(h, record)
+		spans := idx.Rows[k]
+		if last := len(spans) - 1; last >= 0 && spans[last][0]+spans[last][1] == bom+start {
+			spans[last][1] += end - start
+		} else {
+			idx.Rows[k] = append(spans, RowSpan{bom + start, end - start, int64(lines.lineAt(start))})
+		}
+		start = end
+	}
+	return idx, nil
+}
+
+// Matches reports whether the index is of the file info describes as it is now, keyed by the column or columns
+// given, and in the format this build writes
+func (idx *RowIndex) Matches(info os.FileInfo, key string) bool {
+	return idx.Version == rowIndexVersion && idx.Size == info.Size() && idx.ModTime.Equal(info.ModTime()) && idx.Key == key
+}
+
+// Reader returns the header and the rows of the keys given from the indexed file, in file order
+// Its FileLine method gives the line of the file a line of what it returns was read from, for Options.FileLine
+func (idx *RowIndex) Reader(r io.ReaderAt, keys []string) *RowReader {
+	spans := make([]RowSpan, 0)
+	seen := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		if !seen[k] {
+			seen[k] = true
+			spans = append(spans, idx.Rows[k]...)
+		}
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i][0] < spans[j][0] })
+
+	rows := &RowReader{
+		sections: []rowSection{{io.NewSectionReader(r, 0, idx.Header), 1}},
+		starts:   []lineStart{{read: 1, file: 1}},
+	}
+	for _, span := range spans {
+		rows.sections = append(rows.sections, rowSection{io.NewSectionReader(r, span[0], span[1]), int(span[2])})
+	}
+	return rows
+}
+
+// RowReader reads the header and some spans of rows of an indexed file one after another, keeping track of
+// the line of the file each span starts on
+type RowReader struct {
+	sections []rowSection
+	newlines int
+	starts   []lineStart
+}
+
+// rowSection is a span of an indexed file and the line it starts on
+type rowSection struct {
+	reader *io.SectionReader
+	line   int
+}
+
+// lineStart is the line of what a RowReader returns that a section starts on, and its line in the file
+type lineStart struct {
+	read int
+	file int
+}
+
+func (r *RowReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	for len(r.sections) > 0 {
+		n, err := r.sections[0].reader.Read(p)
+		r.newlines += bytes.Count(p[:n], []byte{'\n'})
+		if err == io.EOF {
+			r.sections = r.sections[1:]
+			if len(r.sections) > 0 {
+				r.starts = append(r.starts, lineStart{read: r.newlines + 1, file: r.sections[0].line})
+			}
+			err = nil
+		}
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+	return 0, io.EOF
+}
+
+// FileLine returns the line of the indexed file that line of what's been read came from
+func (r *RowReader) FileLine(line int) int {
+	i := sort.Search(len(r.starts), func(i int) bool { return r.starts[i].read > line }) - 1
+	if i < 0 {
+		return line
+	}
+	return r.starts[i].file + line - r.starts[i].read
+}
+
+// lineCounter counts the lines of what's read through it, so the line a byte offset is on can be found
+// after a csv.Reader has buffered past it
+// Offsets asked about must not go down, so only the newlines beyond the last one need keeping
+type lineCounter struct {
+	r        io.Reader
+	offset   int64
+	lines    int
+	newlines []int64
+}
+
+func (c *lineCounter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	for i, b := range p[:n] {
+		if b == '\n' {
+			c.newlines = append(c.newlines, c.offset+int64(i))
+		}
+	}
+	c.offset += int64(n)
+	return n, err
+}
+
+// lineAt returns the line the byte at offset is on, counting from 1
+func (c *lineCounter) lineAt(offset int64) int {
+	passed := 0
+	for passed < len(c.newlines) && c.newlines[passed] < offset {
+		passed++
+	}
+	c.lines += passed
+	c.newlines = c.newlines[passed:]
+	return c.lines + 1
+}
+
+// ReadRowIndex reads the spans of the keys given from a row index written by WriteRowIndex, skipping the rest
+// so a few keys can be read from the index of a large file without decoding all of it
+func ReadRowIndex(fileName string, keys []string) (*RowIndex, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	wanted := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		wanted[k] = true
+	}
+
+	// The first line describes the indexed file and each following one is a key and its spans
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	idx := &RowIndex{}
+	if !scanner.Scan() {
+		return nil, fmt.Errorf("%s: empty row index", fileName)
+	}
+	if err := json.Unmarshal(scanner.Bytes(), idx); err != nil {
+		return nil, fmt.Errorf("%s: %w", fileName, err)
+	}
+	if idx.Version != rowIndexVersion {
+		return idx, nil
+	}
+	idx.Rows = make(map[string][]RowSpan, len(keys))
+	for line := 2; scanner.Scan(); line++ {
+		k, spans, found := bytes.Cut(scanner.Bytes(), []byte{'\t'})
+		if !found {
+			return nil, fmt.Errorf("%s:%d: expected a key and its spans", fileName, line)
+		}
+		if !wanted[string(k)] {
+			continue
+		}
+		fields := strings.Fields(string(spans))
+		if len(fields)%3 != 0 {
+			return nil, fmt.Errorf("%s:%d: expected offset, length and line triples", fileName, line)
+		}
+		for i := 0; i < len(fields); i += 3 {
+			var span RowSpan
+			for j := range span {
+				n, err := strconv.ParseInt(fields[i+j], 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("%s:%d: %w", fileName, line, err)
+				}
+				span[j] = n
+			}
+			idx.Rows[string(k)] = append(idx.Rows[string(k)], span)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", fileName, err)
+	}
+	return idx, nil
+}
+
+// WriteRowIndex writes a row index to the named file, as a line of JSON describing the indexed file
+// followed by a line for each key with the offset, length and starting line of each of its spans
+func WriteRowIndex(fileName string, idx *RowIndex) error {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+
+	description := *idx
+	description.Rows = nil
+	data, err := json.Marshal(description)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	w.Write(data)
+	w.WriteByte('\n')
+
+	keys := make([]string, 0, len(idx.Rows))
+	for k := range idx.Rows {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		w.WriteString(k)
+		w.WriteByte('\t')
+		for i, span := range idx.Rows[k] {
+			if i > 0 {
+				w.WriteByte(' ')
+			}
+			fmt.Fprintf(w, "%d %d %d", span[0], span[1], span[2])
+		}
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,46 @@
+package source
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"slcsp/model"
+)
+
+// TestRowReaderLines checks errors in rows read through a row index give the lines of the file, past
+// rows of other keys and a quoted field over several lines
+func TestRowReaderLines(t *testing.T) {
+	plans := "plan_id,state,metal_level,rate,rate_area\n" +
+		"A,MO,Silver,200.00,3\n" +
+		"\"B\n\n\",KS,Silver,250.00,1\n" +
+		"C,KS,Silver,300.00,1\n" +
+		"D,MO,Silver,abc,3\n"
+	idx, err := IndexPlanRows("plans.csv", strings.NewReader(plans), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows := idx.Reader(strings.NewReader(plans), []string{model.RateArea{State: "MO", Code: "3"}.Key()})
+	_, err = ReadPlans("plans.csv", rows, Options{FileLine: rows.FileLine})
+	var recordErr *RecordError
+	if !errors.As(err, &recordErr) || recordErr.Line != 7 {
+		t.Errorf("error %v, want a RecordError on line 7 of the file", err)
+	}
+}
+
+// TestIndexRowsOptions checks a file is indexed as opts read it, here sniffed as tab delimited after a
+// byte order mark, with the offsets of the file rather than of the text after the mark
+func TestIndexRowsOptions(t *testing.T) {
+	zips := "\xef\xbb\xbfzipcode\tstate\tcounty_code\tname\trate_area\n" +
+		"64148\tMO\t29095\tJackson\t3\n" +
+		"67118\tKS\t20095\tKingman\t6\n"
+	idx, err := IndexZipRows("zips.csv", strings.NewReader(zips), Options{Sniff: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	span := idx.Rows["67118"]
+	if want := strings.Index(zips, "67118"); len(span) != 1 || span[0][0] != int64(want) || span[0][2] != 3 {
+		t.Errorf("spans of 67118 = %v, want one at offset %d on line 3", span, want)
+	}
+}
@@ -0,0 +1,255 @@
+package source
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"io"
+	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Encodings a file can be sniffed as
+const (
+	EncodingUTF8        = "UTF-8"
+	EncodingUTF16LE     = "UTF-16LE"
+	EncodingUTF16BE     = "UTF-16BE"
+	EncodingWindows1252 = "Windows-1252"
+)
+
+// CandidateDelimiters are the delimiters a file's fields can be sniffed as separated by, in order of preference
+var CandidateDelimiters = []rune{',', '\t', ';', '|'}
+
+// sniffSize is how much of the start of a file is looked at to sniff how it's written
+const sniffSize = 64 * 1024
+
+// Sniffed is how a file read with Options.Sniff was found to be written
+// BOM is the length of the byte order mark skipped at its start, if it had one
+type Sniffed struct {
+	File      string
+	Encoding  string
+	Delimiter rune
+	Header    bool
+	BOM       int
+}
+
+// DetectDelimiter guesses the delimiter of a file from its first line
+// The candidate occurring most often outside of quotes wins, defaulting to a comma
+func DetectDelimiter(firstLine []byte) rune {
+	counts := make(map[rune]int)
+	quoted := false
+	for _, c := range string(firstLine) {
+		if c == '"' {
+			quoted = !quoted
+		} else if !quoted {
+			counts[c]++
+		}
+	}
+
+	delimiter := CandidateDelimiters[0]
+	for _, candidate := range CandidateDelimiters {
+		if counts[candidate] > counts[delimiter] {
+			delimiter = candidate
+		}
+	}
+	return delimiter
+}
+
+// sniff works out the encoding, delimiter and header of a file if opts.Sniff is set, from the start of it,
+// returning a reader of it as UTF-8 without a byte order mark and the options to read that with
+// columns are the names its header would have any of; a first line with none of them is still a header if
+// a column of it isn't a number where the same column of the next line is, as with a misspelled header
+// A file that can't be read is left for the error to be met reading it
+func (opts Options) sniff(fileName string, r io.Reader, columns ...string) (io.Reader, Options) {
+	if !opts.Sniff {
+		return r, opts
+	}
+	buffered := bufio.NewReaderSize(r, sniffSize)
+	start, _ := buffered.Peek(sniffSize)
+	encoding, bom := detectEncoding(start, len(start) < sniffSize)
+	buffered.Discard(bom)
+	decoded := io.Reader(buffered)
+	switch encoding {
+	case EncodingUTF16LE, EncodingUTF16BE:
+		decoded = bufio.NewReaderSize(&decodingReader{src: buffered, next: utf16Decoder(encoding == EncodingUTF16BE)}, sniffSize)
+	case EncodingWindows1252:
+		decoded = bufio.NewReaderSize(&decodingReader{src: buffered, next: decodeWindows1252}, sniffSize)
+	}
+	if encoding != EncodingUTF8 {
+		start, _ = decoded.(*bufio.Reader).Peek(sniffSize)
+	} else {
+		start = start[bom:]
+	}
+
+	firstLine := start
+	if i := bytes.IndexByte(firstLine, '\n'); i >= 0 {
+		firstLine = firstLine[:i]
+	}
+	sniffed := Sniffed{File: fileName, Encoding: encoding, Delimiter: DetectDelimiter(firstLine), BOM: bom}
+	sniffed.Header = detectHeader(start, sniffed.Delimiter, opts, columns)
+
+	opts.Delimiter = sniffed.Delimiter
+	opts.NoHeader = !sniffed.Header
+	if opts.OnSniff != nil {
+		opts.OnSniff(sniffed)
+	}
+	return decoded, opts
+}
+
+// detectEncoding guesses the encoding of a file from its start, returning the length of its byte order
+// mark if it has one
+// Without one, a file with a zero byte in every other position is UTF-16, and one that isn't valid UTF-8 is
+// taken to be Windows-1252, as exported by spreadsheets on Windows
+// whole is set when start is the whole file, so it can't end part way through a character
+func detectEncoding(start []byte, whole bool) (string, int) {
+	switch {
+	case bytes.HasPrefix(start, []byte{0xEF, 0xBB, 0xBF}):
+		return EncodingUTF8, 3
+	case bytes.HasPrefix(start, []byte{0xFF, 0xFE}):
+		return EncodingUTF16LE, 2
+	case bytes.HasPrefix(start, []byte{0xFE, 0xFF}):
+		return EncodingUTF16BE, 2
+	}
+
+	zeros := [2]int{}
+	for i, b := range start {
+		if b == 0 {
+			zeros[i%2]++
+		}
+	}
+	half := len(start) / 2
+	switch {
+	case half > 0 && zeros[1] > half*9/10 && zeros[0] == 0:
+		return EncodingUTF16LE, 0
+	case half > 0 && zeros[0] > half*9/10 && zeros[1] == 0:
+		return EncodingUTF16BE, 0
+	}
+
+	if !whole {
+		// Leave out a character cut off at the end of what was looked at
+		for cut := 1; cut < utf8.UTFMax && cut <= len(start); cut++ {
+			if utf8.RuneStart(start[len(start)-cut]) {
+				if !utf8.FullRune(start[len(start)-cut:]) {
+					start = start[:len(start)-cut]
+				}
+				break
+			}
+		}
+	}
+	if !utf8.Valid(start) {
+		return EncodingWindows1252, 0
+	}
+	return EncodingUTF8, 0
+}
+
+// detectHeader reports whether the first line of a file's start is a header, going by columns
+func detectHeader(start []byte, delimiter rune, opts Options, columns []string) bool {
+	reader := csv.NewReader(bytes.NewReader(start))
+	reader.Comma = delimiter
+	reader.LazyQuotes = true
+	reader.FieldsPerRecord = -1
+	first, err := reader.Read()
+	if err != nil {
+		return !opts.NoHeader
+	}
+
+	names := make(map[string]bool)
+	for _, column := range columns {
+		names[normalizeColumnName(opts.columnName(column))] = true
+	}
+	for _, field := range first {
+		if names[normalizeColumnName(field)] {
+			return true
+		}
+	}
+
+	second, err := reader.Read()
+	if err != nil {
+		return false
+	}
+	for i := 0; i < len(first) && i < len(second); i++ {
+		if !isNumber(first[i]) && isNumber(second[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// isNumber reports whether a field holds a number
+func isNumber(field string) bool {
+	_, err := strconv.ParseFloat(field, 64)
+	return err == nil
+}
+
+// decodingReader reads the UTF-8 of text in another encoding, decoded a character at a time by next
+type decodingReader struct {
+	src  *bufio.Reader
+	next func(src *bufio.Reader) (rune, error)
+}
+
+// Read fills p with as many whole characters as fit
+func (d *decodingReader) Read(p []byte) (int, error) {
+	n := 0
+	for n+utf8.UTFMax <= len(p) {
+		c, err := d.next(d.src)
+		if err != nil {
+			if n > 0 && err == io.EOF {
+				return n, nil
+			}
+			return n, err
+		}
+		n += utf8.EncodeRune(p[n:], c)
+	}
+	return n, nil
+}
+
+// utf16Decoder returns a decoder of UTF-16 characters, with surrogate pairs for those outside the BMP
+func utf16Decoder(bigEndian bool) func(src *bufio.Reader) (rune, error) {
+	unit := func(src *bufio.Reader) (rune, error) {
+		var b [2]byte
+		if _, err := io.ReadFull(src, b[:]); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				return utf8.RuneError, nil
+			}
+			return 0, err
+		}
+		if bigEndian {
+			return rune(b[0])<<8 | rune(b[1]), nil
+		}
+		return rune(b[1])<<8 | rune(b[0]), nil
+	}
+	return func(src *bufio.Reader) (rune, error) {
+		c, err := unit(src)
+		if err != nil || !utf16.IsSurrogate(c) {
+			return c, err
+		}
+		if c >= 0xDC00 {
+			// A low surrogate without the high one before it
+			return utf8.RuneError, nil
+		}
+		low, err := unit(src)
+		if err != nil {
+			return utf8.RuneError, nil
+		}
+		return utf16.DecodeRune(c, low), nil
+	}
+}
+
+// windows1252 holds the characters Windows-1252 has in place of the C1 controls of Latin-1, at 0x80 to 0x9F
+var windows1252 = [32]rune{
+	'€', utf8.RuneError, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', utf8.RuneError, 'Ž', utf8.RuneError,
+	utf8.RuneError, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', utf8.RuneError, 'ž', 'Ÿ',
+}
+
+// decodeWindows1252 decodes a Windows-1252 character, which is a byte
+func decodeWindows1252(src *bufio.Reader) (rune, error) {
+	b, err := src.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if b >= 0x80 && b < 0xA0 {
+		return windows1252[b-0x80], nil
+	}
+	return rune(b), nil
+}
@@ -0,0 +1,81 @@
+package source
+
+import (
+	"errors"
+	"sync"
+)
+
+// ReadStats counts the records read from each file and those skipped, for a report on a run
+// One can be shared by the Options of files read at the same time
+type ReadStats struct {
+	mu    sync.Mutex
+	files map[string]*FileStats
+}
+
+// FileStats are the counts of one file
+// Rows is the number of records parsed, not counting the header; Skipped is the number of those, or of
+// records that couldn't be parsed, that were passed over for a problem, such as under BadRatesSkip
+type FileStats struct {
+	Rows    int `json:"rows"`
+	Skipped int `json:"skipped"`
+}
+
+// Files returns a copy of the counts of each file read so far, keyed by file name
+func (s *ReadStats) Files() map[string]FileStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	files := make(map[string]FileStats, len(s.files))
+	for name, stats := range s.files {
+		files[name] = *stats
+	}
+	return files
+}
+
+// add adds to the counts of a file
+func (s *ReadStats) add(fileName string, rows int, skipped int) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.files == nil {
+		s.files = make(map[string]*FileStats)
+	}
+	stats, exists := s.files[fileName]
+	if !exists {
+		stats = &FileStats{}
+		s.files[fileName] = stats
+	}
+	stats.Rows += rows
+	stats.Skipped += skipped
+}
+
+// skipped counts a record skipped for err, if it's a RecordError saying which file it's in
+func (s *ReadStats) skipped(err error) {
+	var recordErr *RecordError
+	if s != nil && errors.As(err, &recordErr) {
+		s.add(recordErr.File, 0, 1)
+	}
+}
+
+// countingReader counts the records parsed from a file in Options.Stats
+type countingReader struct {
+	recordReader
+	fileName string
+	stats    *ReadStats
+	// header is true until the header, which isn't counted, has been read
+	header bool
+}
+
+func (c *countingReader) Read() ([]string, error) {
+	record, err := c.recordReader.Read()
+	if err != nil {
+		return record, err
+	}
+	if c.header {
+		c.header = false
+	} else {
+		c.stats.add(c.fileName, 1, 0)
+	}
+	return record, nil
+}
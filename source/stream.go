@@ -0,0 +1,60 @@
+package source
+
+import (
+	"errors"
+	"io"
+	"iter"
+
+	"slcsp/model"
+)
+
+// Queries reads a file shaped like slcsp.csv as it's iterated, yielding a Result for each zip code in it
+// without holding the whole file in memory
+// An error reading the file is yielded with an empty Result and ends the iteration; problems with
+// records are collected and yielded together at the end, unless opts.OnError handles them
+func Queries(fileName string, r io.Reader, opts Options) iter.Seq2[model.Result, error] {
+	return func(yield func(model.Result, error) bool) {
+		r, opts := opts.sniff(fileName, r, QueryLayout...)
+		queryReader := newReader(fileName, r, opts)
+		problems := &recordErrors{opts: opts}
+
+		// Find the columns from the first line (header)
+		// An empty query file has no results rather than being an error
+		h, err := readHeader(fileName, queryReader, opts, QueryLayout, nil, ColZipcode)
+		var noData *NoDataError
+		if errors.As(err, &noData) {
+			return
+		}
+		if err != nil {
+			yield(model.Result{}, err)
+			return
+		}
+
+		// Read file data
+		for {
+			record, err := queryReader.Read()
+
+			// Stop at end of file, with any problems with its records
+			if err == io.EOF {
+				if err := problems.err(); err != nil {
+					yield(model.Result{}, err)
+				}
+				return
+			}
+
+			if err != nil {
+				if err := problems.skip(WrapReadError(fileName, err)); err != nil {
+					yield(model.Result{}, err)
+					return
+				}
+				continue
+			}
+
+			// Only keep the zipcode field since rate will be empty here
+			line, _ := queryReader.FieldPos(h[ColZipcode])
+			if !yield(model.Result{Zip: record[h[ColZipcode]], Line: line}, nil) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package source
+
+// ZipFilter is a set of zip codes, so the rows of a large file for zip codes that aren't in it can be
+// left out as they're read
+// A bloom filter in front of the map was tried and was no faster for a few zip codes, and slower for
+// thousands; BenchmarkZipFilter compares the two
+type ZipFilter struct {
+	zips map[string]struct{}
+}
+
+// NewZipFilter creates a ZipFilter holding zips
+func NewZipFilter(zips []string) *ZipFilter {
+	f := &ZipFilter{zips: make(map[string]struct{}, len(zips))}
+	for _, zip := range zips {
+		f.zips[zip] = struct{}{}
+	}
+	return f
+}
+
+// Contains reports whether zip is in the set
+func (f *ZipFilter) Contains(zip string) bool {
+	_, exists := f.zips[zip]
+	return exists
+}
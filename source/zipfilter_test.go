@@ -0,0 +1,95 @@
+package source
+
+import (
+	"fmt"
+	"testing"
+)
+
+// bloomZipFilter is a ZipFilter fronted by a bloom filter, with roughly a 1% false positive rate, kept to
+// compare with ZipFilter in BenchmarkZipFilter
+type bloomZipFilter struct {
+	bits []uint64
+	zips *ZipFilter
+}
+
+// Bloom filter sizing
+const (
+	filterBitsPerZip = 10
+	filterHashes     = 7
+)
+
+func newBloomZipFilter(zips []string) *bloomZipFilter {
+	words := max((len(zips)*filterBitsPerZip+63)/64, 1)
+	f := &bloomZipFilter{bits: make([]uint64, words), zips: NewZipFilter(zips)}
+	for _, zip := range zips {
+		h1, h2 := filterHash(zip)
+		for i := uint64(0); i < filterHashes; i++ {
+			bit := (h1 + i*h2) % uint64(len(f.bits)*64)
+			f.bits[bit/64] |= 1 << (bit % 64)
+		}
+	}
+	return f
+}
+
+func (f *bloomZipFilter) Contains(zip string) bool {
+	h1, h2 := filterHash(zip)
+	for i := uint64(0); i < filterHashes; i++ {
+		bit := (h1 + i*h2) % uint64(len(f.bits)*64)
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return f.zips.Contains(zip)
+}
+
+// filterHash returns the two hashes of zip the bloom filter's bit positions are derived from, FNV-1a
+func filterHash(zip string) (uint64, uint64) {
+	sum := uint64(14695981039346656037)
+	for i := 0; i < len(zip); i++ {
+		sum ^= uint64(zip[i])
+		sum *= 1099511628211
+	}
+	return sum, sum>>32 | 1
+}
+
+// zipFilterWorkload returns a set of queried zip codes and the zip codes of a file to filter by it, most
+// of which aren't in the set, as when a few zip codes are looked up in a national zips file
+func zipFilterWorkload(queried int) ([]string, []string) {
+	set := make([]string, queried)
+	for i := range set {
+		set[i] = fmt.Sprintf("%05d", i*7)
+	}
+	rows := make([]string, 100000)
+	for i := range rows {
+		rows[i] = fmt.Sprintf("%05d", i)
+	}
+	return set, rows
+}
+
+// BenchmarkZipFilter compares ZipFilter, a map, with the map fronted by a bloom filter, for a few queried
+// zip codes and for many
+func BenchmarkZipFilter(b *testing.B) {
+	for _, queried := range []int{50, 10000} {
+		set, rows := zipFilterWorkload(queried)
+
+		b.Run(fmt.Sprintf("bloom+map/%d", queried), func(b *testing.B) {
+			filter := newBloomZipFilter(set)
+			b.ResetTimer()
+			for range b.N {
+				for _, zip := range rows {
+					filter.Contains(zip)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("map/%d", queried), func(b *testing.B) {
+			filter := NewZipFilter(set)
+			b.ResetTimer()
+			for range b.N {
+				for _, zip := range rows {
+					filter.Contains(zip)
+				}
+			}
+		})
+	}
+}
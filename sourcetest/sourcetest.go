@@ -0,0 +1,170 @@
+// Package sourcetest injects failures into the data a resolver.Resolver loads, so services embedding it
+// can test how they handle a bad file, a slow disk or a failed reload without arranging for one
+// Every failure is set up in advance and happens at the same place on every run
+//
+//	files := source.Files{Zips: "zips.csv", Plans: "plans.csv", FS: sourcetest.FS{
+//		FS:     os.DirFS("testdata"),
+//		Faults: map[string]sourcetest.Fault{"plans.csv": {ErrAtLine: 100}},
+//	}}
+//	_, err := resolver.Open(ctx, resolver.WithSources(files)) // errors.Is(err, sourcetest.ErrInjected)
+package sourcetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"sync"
+	"time"
+
+	"slcsp/model"
+	"slcsp/resolver"
+)
+
+// ErrInjected is the error a Fault or Source fails with when it isn't given one
+var ErrInjected = errors.New("sourcetest: injected failure")
+
+// LineError is the error a Fault's ErrAtLine fails with, giving the line
+// It's a failure to read the file, as from a disk error, rather than a source.RecordError, so reading
+// stops at it even with Options.OnError set
+type LineError struct {
+	Line int
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// Fault is what goes wrong reading a file of an FS
+// ErrAtLine fails the read of the line given, counting the header as line 1, after the lines before it
+// have been read; zero for none
+// Err is the error it fails with, wrapped in a LineError, ErrInjected if nil
+// Delay is how long every read of the file takes, as from a slow disk or network share
+// TruncateAt ends the file after this many bytes, as if it was cut short while being copied, perhaps part
+// way through a record; zero for the whole file
+type Fault struct {
+	ErrAtLine  int
+	Err        error
+	Delay      time.Duration
+	TruncateAt int64
+}
+
+// FS is a file system whose files fail as their Faults say, such as the FS of a source.Files
+// Files without a Fault are read from FS as they are
+type FS struct {
+	FS     fs.FS
+	Faults map[string]Fault
+}
+
+// Open opens a file of the wrapped FS, which fails as its Fault says
+func (f FS) Open(name string) (fs.File, error) {
+	file, err := f.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	fault, exists := f.Faults[name]
+	if !exists {
+		return file, nil
+	}
+	return &faultyFile{File: file, fault: fault}, nil
+}
+
+// faultyFile is a file read through its Fault
+type faultyFile struct {
+	fs.File
+	fault Fault
+	// lines is how many lines have been read, and read how many bytes
+	lines int
+	read  int64
+}
+
+// Read reads from the file, stopping at the line of the fault or the truncation
+func (f *faultyFile) Read(p []byte) (int, error) {
+	if f.fault.Delay > 0 {
+		time.Sleep(f.fault.Delay)
+	}
+	if f.fault.ErrAtLine > 0 && f.lines >= f.fault.ErrAtLine-1 {
+		err := f.fault.Err
+		if err == nil {
+			err = ErrInjected
+		}
+		return 0, &LineError{Line: f.fault.ErrAtLine, Err: err}
+	}
+	if f.fault.TruncateAt > 0 {
+		if f.read >= f.fault.TruncateAt {
+			return 0, io.EOF
+		}
+		p = p[:min(int64(len(p)), f.fault.TruncateAt-f.read)]
+	}
+
+	n, err := f.File.Read(p)
+	// End the read after the line before the failing one, so every line before it is read whole
+	if f.fault.ErrAtLine > 0 {
+		for i := 0; i < n; i++ {
+			if p[i] != '\n' {
+				continue
+			}
+			f.lines++
+			if f.lines == f.fault.ErrAtLine-1 {
+				n, err = i+1, nil
+				break
+			}
+		}
+	}
+	f.read += int64(n)
+	return n, err
+}
+
+// Source is a resolver.Source whose loads fail or are slow as set
+// FailOn lists the loads that fail, counting the first as 1, such as 2 for the first Reload after Open;
+// a load fails with Err, ErrInjected if nil, without loading Source
+// Delay is how long every load waits first, or until its context is done
+type Source struct {
+	Source resolver.Source
+	FailOn []int
+	Err    error
+	Delay  time.Duration
+
+	mu    sync.Mutex
+	loads int
+}
+
+// Load loads the wrapped Source, unless this load is one that fails
+func (s *Source) Load(ctx context.Context) (*model.Dataset, error) {
+	s.mu.Lock()
+	s.loads++
+	load := s.loads
+	s.mu.Unlock()
+
+	if s.Delay > 0 {
+		timer := time.NewTimer(s.Delay)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+	for _, fail := range s.FailOn {
+		if fail == load {
+			if s.Err != nil {
+				return nil, s.Err
+			}
+			return nil, ErrInjected
+		}
+	}
+	return s.Source.Load(ctx)
+}
+
+// Loads returns how many times Load has been called
+func (s *Source) Loads() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.loads
+}
@@ -0,0 +1,167 @@
+package sourcetest_test
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"slcsp/resolver"
+	"slcsp/source"
+	"slcsp/sourcetest"
+)
+
+const (
+	zipsCSV = "zipcode,state,county_code,name,rate_area\n" +
+		"64148,MO,29095,Jackson,3\n"
+	plansCSV = "plan_id,state,metal_level,rate,rate_area\n" +
+		"A,MO,Silver,200.00,3\n" +
+		"B,MO,Silver,250.00,3\n" +
+		"C,MO,Silver,300.00,3\n" +
+		"D,MO,Gold,350.00,3\n"
+)
+
+// files returns the sample files, read through faults for plans.csv
+func files(fault sourcetest.Fault) source.Files {
+	fsys := fstest.MapFS{
+		"zips.csv":  {Data: []byte(zipsCSV)},
+		"plans.csv": {Data: []byte(plansCSV)},
+	}
+	return source.Files{
+		Zips:  "zips.csv",
+		Plans: "plans.csv",
+		FS:    sourcetest.FS{FS: fsys, Faults: map[string]sourcetest.Fault{"plans.csv": fault}},
+	}
+}
+
+// readPlans reads plans.csv through a fault
+func readPlans(t *testing.T, fault sourcetest.Fault) (string, error) {
+	t.Helper()
+	file, err := files(fault).FS.Open("plans.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	return string(data), err
+}
+
+func TestErrAtLine(t *testing.T) {
+	data, err := readPlans(t, sourcetest.Fault{ErrAtLine: 3})
+	if want := strings.Join(strings.SplitAfter(plansCSV, "\n")[:2], ""); data != want {
+		t.Errorf("read %q before the failure, want the lines before line 3, %q", data, want)
+	}
+	var lineErr *sourcetest.LineError
+	if !errors.As(err, &lineErr) || lineErr.Line != 3 || !errors.Is(err, sourcetest.ErrInjected) {
+		t.Errorf("error %v, want a LineError at line 3 wrapping ErrInjected", err)
+	}
+
+	_, err = resolver.Load(context.Background(), files(sourcetest.Fault{ErrAtLine: 3}))
+	if !errors.As(err, &lineErr) || lineErr.Line != 3 || !errors.Is(err, sourcetest.ErrInjected) {
+		t.Errorf("Load error %v, want a LineError at line 3 wrapping ErrInjected", err)
+	}
+	var recordErr *source.RecordError
+	if errors.As(err, &recordErr) {
+		t.Errorf("Load error %v is a RecordError, which would be skipped rather than stop reading", err)
+	}
+	if !strings.HasPrefix(err.Error(), "plans.csv: ") {
+		t.Errorf("Load error %q doesn't name the file", err)
+	}
+}
+
+func TestErrAtLineOwnError(t *testing.T) {
+	diskErr := errors.New("disk on fire")
+	_, err := resolver.Load(context.Background(), files(sourcetest.Fault{ErrAtLine: 1, Err: diskErr}))
+	var lineErr *sourcetest.LineError
+	if !errors.Is(err, diskErr) || errors.Is(err, sourcetest.ErrInjected) || !errors.As(err, &lineErr) || lineErr.Line != 1 {
+		t.Errorf("error %v, want a LineError at line 1 wrapping the error given", err)
+	}
+}
+
+// TestErrAtLineKeepGoing checks an injected failure stops reading even when record errors are skipped
+func TestErrAtLineKeepGoing(t *testing.T) {
+	f := files(sourcetest.Fault{ErrAtLine: 3})
+	skipped := 0
+	f.PlansOptions.OnError = func(err error) error {
+		skipped++
+		return nil
+	}
+	if _, err := resolver.Load(context.Background(), f); !errors.Is(err, sourcetest.ErrInjected) {
+		t.Errorf("error %v with OnError set, want ErrInjected", err)
+	}
+	if skipped != 0 {
+		t.Errorf("OnError was called %d times for an injected failure", skipped)
+	}
+}
+
+func TestTruncateAt(t *testing.T) {
+	// Part way through line 3, "B,MO,Silver,250.00,3"
+	cut := strings.Index(plansCSV, "B,MO,") + len("B,MO,")
+	data, err := readPlans(t, sourcetest.Fault{TruncateAt: int64(cut)})
+	if err != nil || data != plansCSV[:cut] {
+		t.Errorf("read %q, %v, want %q with no error", data, err, plansCSV[:cut])
+	}
+
+	_, err = resolver.Load(context.Background(), files(sourcetest.Fault{TruncateAt: int64(cut)}))
+	var recordErr *source.RecordError
+	if !errors.As(err, &recordErr) || recordErr.File != "plans.csv" || recordErr.Line != 3 || !errors.Is(err, csv.ErrFieldCount) {
+		t.Errorf("Load error %v, want a RecordError for the short record on plans.csv line 3", err)
+	}
+}
+
+// TestTruncateAtLineEnd checks a file cut short between records reads without error, as its rows are whole
+func TestTruncateAtLineEnd(t *testing.T) {
+	cut := strings.Index(plansCSV, "C,MO,")
+	r, err := resolver.Load(context.Background(), files(sourcetest.Fault{TruncateAt: int64(cut)}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result := r.Lookup("64148"); result.Rate == nil || *result.Rate != 250 {
+		t.Errorf("benchmark %v, want 250 from the two plans before the cut", result.Rate)
+	}
+}
+
+func TestDelay(t *testing.T) {
+	const delay = 20 * time.Millisecond
+	start := time.Now()
+	if _, err := readPlans(t, sourcetest.Fault{Delay: delay}); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < delay {
+		t.Errorf("read took %s, want at least %s", elapsed, delay)
+	}
+}
+
+func TestSourceFailOn(t *testing.T) {
+	ctx := context.Background()
+	src := &sourcetest.Source{Source: files(sourcetest.Fault{}), FailOn: []int{2}}
+	r, err := resolver.Open(ctx, resolver.WithSources(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reload(ctx); !errors.Is(err, sourcetest.ErrInjected) {
+		t.Errorf("second load error %v, want ErrInjected", err)
+	}
+	if result := r.Lookup("64148"); result.Rate == nil || *result.Rate != 250 {
+		t.Errorf("benchmark %v after the failed reload, want 250 from the index kept", result.Rate)
+	}
+	if _, err := r.Reload(ctx); err != nil {
+		t.Errorf("third load error %v, want none", err)
+	}
+	if loads := src.Loads(); loads != 3 {
+		t.Errorf("Loads() = %d, want 3", loads)
+	}
+}
+
+func TestSourceDelay(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	src := &sourcetest.Source{Source: files(sourcetest.Fault{}), Delay: time.Hour}
+	if _, err := resolver.Open(ctx, resolver.WithSources(src)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error %v, want the context's deadline", err)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"slcsp/model"
+	"slcsp/resolver"
+)
+
+// stdioRequest is a request read by -stdio, one JSON object per line
+// ID is any JSON value, echoed in the response so a client can match them up
+// Method is lookup, with Zip, bulk, with Zips, or reload, which rereads the zips and plans files
+type stdioRequest struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method"`
+	Zip    string          `json:"zip,omitempty"`
+	Zips   []string        `json:"zips,omitempty"`
+}
+
+// stdioReload is the response to a reload, describing what changed
+type stdioReload struct {
+	Zips              int     `json:"zipcodes"`
+	Plans             int     `json:"plans"`
+	ZipsAdded         int     `json:"zipcodes_added"`
+	ZipsRemoved       int     `json:"zipcodes_removed"`
+	RateAreasAdded    int     `json:"rate_areas_added"`
+	RateAreasRemoved  int     `json:"rate_areas_removed"`
+	BenchmarksChanged int     `json:"benchmarks_changed"`
+	Seconds           float64 `json:"seconds"`
+}
+
+// serveStdio answers the requests read from r with r's resolver, writing a JSON response to w for each,
+// until r ends, so a tool can keep one process with its index loaded rather than starting one per query
+// A response has the request's id and one of result, results, reload or error; a request that can't be
+// understood gets an error rather than ending the session
+// afterReload is called after each reload, such as to log the warnings it gave
+func serveStdio(ctx context.Context, res *resolver.Resolver, r io.Reader, w io.Writer, afterReload func()) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	encoder := json.NewEncoder(w)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var request stdioRequest
+		response := make(map[string]any)
+		if err := json.Unmarshal(scanner.Bytes(), &request); err != nil {
+			response["error"] = fmt.Sprintf("invalid request: %v", err)
+		} else {
+			key, value := answerStdio(ctx, res, request, afterReload)
+			response[key] = value
+		}
+		if request.ID != nil {
+			response["id"] = request.ID
+		}
+		if err := encoder.Encode(response); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// answerStdio answers a request, returning the name and value of the field holding its answer
+func answerStdio(ctx context.Context, res *resolver.Resolver, request stdioRequest, afterReload func()) (string, any) {
+	switch request.Method {
+	case "lookup":
+		if request.Zip == "" {
+			return "error", "lookup needs a zip"
+		}
+		return "result", res.Lookup(request.Zip)
+	case "bulk":
+		results := make([]model.Result, 0, len(request.Zips))
+		for _, zip := range request.Zips {
+			results = append(results, res.Lookup(zip))
+		}
+		return "results", results
+	case "reload":
+		stats, err := res.Reload(ctx)
+		afterReload()
+		if err != nil {
+			return "error", fmt.Sprintf("reload failed, still answering from the previous files: %v", err)
+		}
+		return "reload", stdioReload{
+			Zips:              stats.Zips,
+			Plans:             stats.Plans,
+			ZipsAdded:         stats.ZipsAdded,
+			ZipsRemoved:       stats.ZipsRemoved,
+			RateAreasAdded:    stats.RateAreasAdded,
+			RateAreasRemoved:  stats.RateAreasRemoved,
+			BenchmarksChanged: stats.BenchmarksChanged,
+			Seconds:           stats.Duration.Seconds(),
+		}
+	}
+	return "error", fmt.Sprintf("unknown method %q, expected lookup, bulk or reload", request.Method)
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+
+	"slcsp/resolver"
+	"slcsp/source"
+)
+
+// Map layout, in pixels
+const (
+	mapWidth     = 800
+	mapMargin    = 10
+	legendHeight = 30
+)
+
+// mapPalette is the sequential palette benchmarks are binned into, from cheapest to most expensive
+var mapPalette = []string{"#ffffb2", "#fecc5c", "#fd8d3c", "#f03b20", "#bd0026"}
+
+// mapBlankColor fills zip codes without a benchmark
+const mapBlankColor = "#d9d9d9"
+
+// point is a longitude and latitude pair
+type point [2]float64
+
+// featureRings returns the rings of a Polygon or MultiPolygon geometry, ignoring any other geometry type
+func featureRings(geometry json.RawMessage) ([][]point, error) {
+	var shape struct {
+		Type        string          `json:"type"`
+		Coordinates json.RawMessage `json:"coordinates"`
+	}
+	if len(geometry) == 0 || string(geometry) == "null" {
+		return nil, nil
+	}
+	if err := json.Unmarshal(geometry, &shape); err != nil {
+		return nil, err
+	}
+
+	switch shape.Type {
+	case "Polygon":
+		var rings [][]point
+		err := json.Unmarshal(shape.Coordinates, &rings)
+		return rings, err
+	case "MultiPolygon":
+		var polygons [][][]point
+		if err := json.Unmarshal(shape.Coordinates, &polygons); err != nil {
+			return nil, err
+		}
+		rings := make([][]point, 0)
+		for _, polygon := range polygons {
+			rings = append(rings, polygon...)
+		}
+		return rings, nil
+	default:
+		return nil, nil
+	}
+}
+
+// mapShape is a zip code's outline and the benchmark it's colored by
+type mapShape struct {
+	Zip   string
+	Rings [][]point
+	Rate  *float64
+}
+
+// binColor returns the palette color for a rate between low and high
+func binColor(rate float64, low float64, high float64) string {
+	if high <= low {
+		return mapPalette[len(mapPalette)/2]
+	}
+	bin := int((rate - low) / (high - low) * float64(len(mapPalette)))
+	if bin >= len(mapPalette) {
+		bin = len(mapPalette) - 1
+	}
+	return mapPalette[bin]
+}
+
+// writeSVGMap draws the shapes as an SVG choropleth with a legend of the benchmark bins
+// Longitudes are scaled by the cosine of the middle latitude so the state isn't stretched
+func writeSVGMap(w io.Writer, title string, shapes []mapShape) error {
+	minLon, minLat := math.Inf(1), math.Inf(1)
+	maxLon, maxLat := math.Inf(-1), math.Inf(-1)
+	low, high := math.Inf(1), math.Inf(-1)
+	for _, shape := range shapes {
+		for _, ring := range shape.Rings {
+			for _, p := range ring {
+				minLon, maxLon = math.Min(minLon, p[0]), math.Max(maxLon, p[0])
+				minLat, maxLat = math.Min(minLat, p[1]), math.Max(maxLat, p[1])
+			}
+		}
+		if shape.Rate != nil {
+			low, high = math.Min(low, *shape.Rate), math.Max(high, *shape.Rate)
+		}
+	}
+	if math.IsInf(minLon, 1) {
+		return fmt.Errorf("no zip code boundaries to draw")
+	}
+
+	lonScale := math.Cos((minLat + maxLat) / 2 * math.Pi / 180)
+	spanX := math.Max((maxLon-minLon)*lonScale, 1e-9)
+	spanY := math.Max(maxLat-minLat, 1e-9)
+	scale := (mapWidth - 2*mapMargin) / spanX
+	height := int(spanY*scale) + 2*mapMargin + legendHeight
+
+	project := func(p point) (float64, float64) {
+		return mapMargin + (p[0]-minLon)*lonScale*scale, mapMargin + (maxLat-p[1])*scale
+	}
+
+	fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n", mapWidth, height, mapWidth, height)
+	fmt.Fprintf(w, "<title>%s</title>\n", title)
+	for _, shape := range shapes {
+		color := mapBlankColor
+		label := shape.Zip + ": no benchmark"
+		if shape.Rate != nil {
+			color = binColor(*shape.Rate, low, high)
+			label = fmt.Sprintf("%s: %.2f", shape.Zip, *shape.Rate)
+		}
+
+		var path strings.Builder
+		for _, ring := range shape.Rings {
+			for i, p := range ring {
+				x, y := project(p)
+				command := "L"
+				if i == 0 {
+					command = "M"
+				}
+				fmt.Fprintf(&path, "%s%.1f %.1f", command, x, y)
+			}
+			path.WriteString("Z")
+		}
+		fmt.Fprintf(w, `<path d="%s" fill="%s" stroke="#ffffff" stroke-width="0.3" fill-rule="evenodd"><title>%s</title></path>`+"\n", path.String(), color, label)
+	}
+
+	// Legend of the bins, with the blank color last
+	if !math.IsInf(low, 1) {
+		legendY := height - legendHeight + 5
+		binWidth := (high - low) / float64(len(mapPalette))
+		for i, color := range mapPalette {
+			x := mapMargin + i*130
+			fmt.Fprintf(w, `<rect x="%d" y="%d" width="12" height="12" fill="%s"/>`, x, legendY, color)
+			fmt.Fprintf(w, `<text x="%d" y="%d" font-size="11" font-family="sans-serif">%.0f–%.0f</text>`+"\n", x+16, legendY+10, low+float64(i)*binWidth, low+float64(i+1)*binWidth)
+		}
+		x := mapMargin + len(mapPalette)*130
+		fmt.Fprintf(w, `<rect x="%d" y="%d" width="12" height="12" fill="%s"/>`, x, legendY, mapBlankColor)
+		fmt.Fprintf(w, `<text x="%d" y="%d" font-size="11" font-family="sans-serif">none</text>`+"\n", x+16, legendY+10)
+	}
+	_, err := fmt.Fprintln(w, "</svg>")
+	return err
+}
+
+// runMap implements the `map` command, drawing an SVG choropleth of the benchmarks of a state's zip codes
+func runMap(args []string) error {
+	flags := flag.NewFlagSet("map", flag.ExitOnError)
+	zcta := flags.String("zcta", "", "GeoJSON FeatureCollection of zip code (ZCTA) boundaries")
+	zipProperty := flags.String("zip-property", "", "feature property holding the zip code (default: the first of "+fmt.Sprint(zctaProperties)+" found)")
+	state := flags.String("state", "", "state to draw, e.g. MO")
+	output := flags.String("o", "", "file to write the SVG to (default: stdout)")
+	zips := flags.String("zips", ZipsFileName, "zips file to read")
+	plans := flags.String("plans", PlansFileName, "plans file to read")
+	flags.Parse(args)
+
+	if *zcta == "" || *state == "" {
+		return fmt.Errorf("usage: slcsp map -zcta zcta.geojson -state MO [-o map.svg]")
+	}
+
+	r, err := resolver.Load(context.Background(), source.Files{Zips: *zips, Plans: *plans})
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(*zcta)
+	if err != nil {
+		return err
+	}
+	var collection FeatureCollection
+	if err := json.Unmarshal(data, &collection); err != nil {
+		return fmt.Errorf("%s: %w", *zcta, err)
+	}
+
+	// Keep the zip codes with a rate area in the state
+	shapes := make([]mapShape, 0)
+	for _, feature := range collection.Features {
+		zip := featureZip(feature, *zipProperty)
+		inState := false
+		for _, rateArea := range r.RateAreas(zip) {
+			inState = inState || rateArea.State == *state
+		}
+		if !inState {
+			continue
+		}
+
+		rings, err := featureRings(feature.Geometry)
+		if err != nil {
+			return fmt.Errorf("%s: zip code %s: %w", *zcta, zip, err)
+		}
+		shapes = append(shapes, mapShape{Zip: zip, Rings: rings, Rate: r.Lookup(zip).Rate})
+	}
+
+	title := "Second lowest cost silver plan by zip code, " + *state
+	if *output == "" {
+		return writeSVGMap(os.Stdout, title, shapes)
+	}
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err := writeSVGMap(file, title, shapes); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"slcsp/model"
+)
+
+// ANSI colors of table rows
+const (
+	colorReset     = "\033[0m"
+	colorBlank     = "\033[33m"
+	colorAmbiguous = "\033[31m"
+	colorHeader    = "\033[1m"
+)
+
+// isTerminal reports whether a file is a terminal rather than a pipe or regular file
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// writeTable writes the results as an aligned table with a footer of counts
+// With color, rows without a benchmark are yellow and ambiguous rows red
+func writeTable(w io.Writer, results []model.Result, opts OutputOptions, color bool) error {
+	header, rows := resultRows(results, opts)
+
+	widths := make([]int, len(header))
+	for i, name := range header {
+		widths[i] = utf8.RuneCountInString(name)
+	}
+	for _, row := range rows {
+		for i, value := range row.Record {
+			if width := utf8.RuneCountInString(value); width > widths[i] {
+				widths[i] = width
+			}
+		}
+	}
+
+	// formatRow pads each value to its column's width, right aligning the rate
+	formatRow := func(record []string) string {
+		values := make([]string, len(record))
+		for i, value := range record {
+			padding := strings.Repeat(" ", widths[i]-utf8.RuneCountInString(value))
+			if i == 1 {
+				values[i] = padding + value
+			} else {
+				values[i] = value + padding
+			}
+		}
+		return strings.TrimRight(strings.Join(values, "  "), " ")
+	}
+
+	// paint wraps a line in a color when color is on
+	paint := func(line string, code string) string {
+		if !color || code == "" {
+			return line
+		}
+		return code + line + colorReset
+	}
+
+	if !opts.NoHeader {
+		fmt.Fprintln(w, paint(formatRow(header), colorHeader))
+	}
+	for _, row := range rows {
+		code := ""
+		switch {
+		case row.Result.Ambiguous:
+			code = colorAmbiguous
+		case row.Result.Rate == nil:
+			code = colorBlank
+		}
+		fmt.Fprintln(w, paint(formatRow(row.Record), code))
+	}
+
+	counts := countResults(results)
+	_, err := fmt.Fprintf(w, "\n%d zip codes: %d with a benchmark, %d blank (%d ambiguous)\n", counts.Zips, counts.WithRate, counts.Blank, counts.Ambiguous)
+	return err
+}
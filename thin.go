@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"slcsp/model"
+	"slcsp/resolver"
+)
+
+// thinMarkets is how benchmarks of rate areas with few plans are kept out of results that are shared,
+// whose release rules don't allow a figure that could identify a single issuer's rates
+// Below is the fewest plans a rate area's benchmark is shown for, where zero is no limit; Round is the
+// multiple the benchmarks of rate areas with fewer are rounded to, where zero blanks them instead
+type thinMarkets struct {
+	Below int
+	Round float64
+}
+
+// check returns an error if the limits can't be applied
+func (t thinMarkets) check() error {
+	if t.Below < 0 {
+		return fmt.Errorf("-suppress-below can't be negative")
+	}
+	if t.Round < 0 {
+		return fmt.Errorf("-suppress-round can't be negative")
+	}
+	if t.Round != 0 && t.Below == 0 {
+		return fmt.Errorf("-suppress-round is only used with -suppress-below")
+	}
+	return nil
+}
+
+// thin reports whether a rate area with this many plans in the benchmark pool is a thin market, whose
+// benchmark is blanked or rounded
+func (t thinMarkets) thin(plans int) bool {
+	return plans < t.Below
+}
+
+// applyThinMarkets blanks or rounds the rate of each result in a rate area with fewer than t.Below plans
+// in the benchmark pool, returning how many it changed
+func applyThinMarkets(r *resolver.Resolver, results []model.Result, t thinMarkets) int {
+	if t.Below == 0 {
+		return 0
+	}
+	plans := make(map[model.RateArea]int)
+	for _, summary := range r.RateAreaSummaries() {
+		plans[summary.RateArea] = summary.SilverPlans
+	}
+	changed := 0
+	for i := range results {
+		if results[i].Rate == nil || !t.thin(plans[results[i].RateArea]) {
+			continue
+		}
+		if t.Round == 0 {
+			results[i].Rate = nil
+		} else {
+			rounded := math.Round(*results[i].Rate/t.Round) * t.Round
+			results[i].Rate = &rounded
+		}
+		changed++
+	}
+	return changed
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"slcsp/resolver"
+	"slcsp/source"
+)
+
+// runTrend implements the `trend` command, writing each zip code's benchmark in every labeled dataset
+// as a long-format CSV of zipcode, year and rate
+func runTrend(args []string) error {
+	var datasets datasetsFlag
+	flags := flag.NewFlagSet("trend", flag.ExitOnError)
+	flags.Var(&datasets, "dataset", "a labeled dataset in the form year=zips.csv,plans.csv; repeat for each year")
+	queries := flags.String("queries", "", "only output the zip codes in this "+SlcspFileName+" shaped file, in its order")
+	flags.Parse(args)
+
+	if len(datasets) == 0 {
+		return fmt.Errorf("usage: slcsp trend -dataset 2024=zips.csv,plans.csv [-dataset 2025=zips.csv,plans.csv ...] [-queries slcsp.csv]")
+	}
+
+	// Load every dataset up front so each is resolved the same way
+	ctx := context.Background()
+	resolvers := make([]*resolver.Resolver, 0, len(datasets))
+	for _, dataset := range datasets {
+		r, err := resolver.Load(ctx, dataset.Files)
+		if err != nil {
+			return fmt.Errorf("dataset %s: %w", dataset.Label, err)
+		}
+		resolvers = append(resolvers, r)
+	}
+
+	// Use the queried zip codes if given, otherwise every zip code found in any dataset
+	var zips []string
+	if *queries != "" {
+		results, err := source.ReadQueriesFile(*queries, source.Options{})
+		if err != nil {
+			return err
+		}
+		for _, result := range results {
+			zips = append(zips, result.Zip)
+		}
+	} else {
+		seen := make(map[string]bool)
+		for _, r := range resolvers {
+			for _, zip := range r.Zips() {
+				if !seen[zip] {
+					seen[zip] = true
+					zips = append(zips, zip)
+				}
+			}
+		}
+		sort.Strings(zips)
+	}
+
+	writer := csv.NewWriter(os.Stdout)
+	writer.Write([]string{"zipcode", "year", "slcsp"})
+	for _, zip := range zips {
+		for i, r := range resolvers {
+			writer.Write([]string{zip, datasets[i].Label, formatRate(r.Lookup(zip).Rate)})
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
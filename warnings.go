@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"sync"
+
+	"slcsp/source"
+)
+
+// warningLog groups repeated warnings of the same kind, such as an invalid rate on thousands of rows,
+// so each kind is logged once with a count rather than flooding the log
+// Warnings can come from files read at the same time, so it's safe for concurrent use
+type warningLog struct {
+	// all logs every warning as it's given, for -all-warnings
+	all    bool
+	mu     sync.Mutex
+	groups map[string]*warningGroup
+	order  []string
+}
+
+// warningGroup is the first warning of a kind and how many there have been
+type warningGroup struct {
+	first string
+	count int
+}
+
+// warn logs a warning of the given kind, or holds it to be logged by flush with the others of its kind
+func (w *warningLog) warn(kind string, message string) {
+	if w.all {
+		log.Printf("Warning: %s", message)
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.groups == nil {
+		w.groups = make(map[string]*warningGroup)
+	}
+	group, exists := w.groups[kind]
+	if !exists {
+		group = &warningGroup{first: message}
+		w.groups[kind] = group
+		w.order = append(w.order, kind)
+	}
+	group.count++
+}
+
+// warnError logs a problem skipped while reading a file, grouped by file and kind of problem
+func (w *warningLog) warnError(err error) {
+	w.warn(warningKind(err), err.Error())
+}
+
+// flush logs the warnings held since the last flush, in the order their kinds were first seen, with the
+// number of each kind when there's more than one
+func (w *warningLog) flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, kind := range w.order {
+		group := w.groups[kind]
+		if group.count == 1 {
+			log.Printf("Warning: %s", group.first)
+		} else {
+			log.Printf("Warning: %s (%d occurrences of this warning, the first shown; use -all-warnings to list them all)", group.first, group.count)
+		}
+	}
+	w.groups, w.order = nil, nil
+}
+
+// warningKind is what a problem reading a file is grouped by: the file and the problem with any quoted
+// value left out, so "invalid rate \"\"" and "invalid rate \"0\"" are the same kind
+func warningKind(err error) string {
+	var recordErr *source.RecordError
+	if !errors.As(err, &recordErr) {
+		return err.Error()
+	}
+	problem, _, _ := strings.Cut(recordErr.Err.Error(), `"`)
+	return recordErr.File + ": " + problem
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"slcsp/model"
+)
+
+// isWildcard reports whether a query stands for many zip codes rather than one: a pattern such as 641* or
+// 6414?, or a state followed by *, such as MO*, for every zip code in the state
+func isWildcard(zip string) bool {
+	return strings.ContainsAny(zip, "*?[")
+}
+
+// hasWildcards reports whether any query file has a wildcard query
+func hasWildcards(batches []queryBatch) bool {
+	for _, batch := range batches {
+		for _, result := range batch.Results {
+			if isWildcard(result.Zip) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// stateWildcard returns the state of a wildcard such as MO* standing for a whole state
+func stateWildcard(pattern string) (string, bool) {
+	state, found := strings.CutSuffix(pattern, "*")
+	if !found || len(state) != 2 || !isLetter(state[0]) || !isLetter(state[1]) {
+		return "", false
+	}
+	return strings.ToUpper(state), true
+}
+
+// isLetter reports whether c is an ASCII letter
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// expandWildcards replaces each wildcard query with a query for every zip code of zips it matches, in
+// order and on the wildcard's line, returning the wildcards that match none
+func expandWildcards(results []model.Result, zips []model.ZipMapping) ([]model.Result, []string, error) {
+	states := make(map[string][]string)
+	for _, zip := range zips {
+		state := strings.ToUpper(zip.RateArea.State)
+		if !contains(states[zip.Zip], state) {
+			states[zip.Zip] = append(states[zip.Zip], state)
+		}
+	}
+	sorted := make([]string, 0, len(states))
+	for zip := range states {
+		sorted = append(sorted, zip)
+	}
+	sort.Strings(sorted)
+
+	expanded := make([]model.Result, 0, len(results))
+	unmatched := make([]string, 0)
+	for _, result := range results {
+		if !isWildcard(result.Zip) {
+			expanded = append(expanded, result)
+			continue
+		}
+		state, wholeState := stateWildcard(result.Zip)
+		matched := 0
+		for _, zip := range sorted {
+			matches := wholeState && contains(states[zip], state)
+			if !wholeState {
+				var err error
+				if matches, err = path.Match(result.Zip, zip); err != nil {
+					return nil, nil, fmt.Errorf("query %q on line %d: %w", result.Zip, result.Line, err)
+				}
+			}
+			if matches {
+				expanded = append(expanded, model.Result{Zip: zip, Line: result.Line})
+				matched++
+			}
+		}
+		if matched == 0 {
+			unmatched = append(unmatched, result.Zip)
+		}
+	}
+	return expanded, unmatched, nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import "sync"
+
+// lookupChunkSize is the number of zip codes a worker looks up at a time
+const lookupChunkSize = 1024
+
+// forEach calls fn with each of 0 to n-1, running up to workers calls at once
+func forEach(workers int, n int, fn func(i int)) {
+	if workers < 1 {
+		workers = 1
+	}
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+}